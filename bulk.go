@@ -0,0 +1,331 @@
+package redis_bloom_go
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// BulkTarget selects the kind of structure a bulk load seeds
+type BulkTarget int
+
+const (
+	// BulkBloom adds the items to a Bloom filter with BF.MADD
+	BulkBloom BulkTarget = iota
+	// BulkCuckoo adds the items to a Cuckoo filter with CF.INSERTNX, creating the filter if needed
+	BulkCuckoo
+	// BulkCountMin increments the count of every item by one with CMS.INCRBY
+	BulkCountMin
+)
+
+// BulkLoadOptions configures a bulk load
+type BulkLoadOptions struct {
+	// Target is the kind of structure stored at Key
+	Target BulkTarget
+	// Key is the name of the filter or sketch to seed
+	Key string
+	// BatchSize is the number of items sent per command, 1000 by default
+	BatchSize int
+	// Workers is the number of connections used concurrently, 4 by default
+	Workers int
+	// PipelineDepth is the number of commands each connection has in flight, 8 by default
+	PipelineDepth int
+	// Progress, when set, is called every ProgressInterval with the statistics so far, and once more at the end
+	Progress func(stats BulkLoadStats)
+	// ProgressInterval is the interval between Progress calls, one second by default
+	ProgressInterval time.Duration
+}
+
+// BulkLoadStats is a struct that represents the progress of a bulk load
+type BulkLoadStats struct {
+	// Items is the number of items read from the source. Once the load returns, it is the sum of Added, Present
+	// and Errors.
+	Items int64
+	// Added is the number of items that were not present before. With BulkCountMin every item counts as added.
+	Added int64
+	// Present is the number of items that were (possibly) already present
+	Present int64
+	// Errors is the number of items whose command failed, that could not be encoded, or that were dropped
+	// without being sent because ctx was cancelled
+	Errors int64
+	// Elapsed is the time since the load started
+	Elapsed time.Duration
+}
+
+// Throughput returns the number of items read per second
+func (stats BulkLoadStats) Throughput() float64 {
+	if stats.Elapsed <= 0 {
+		return 0
+	}
+	return float64(stats.Items) / stats.Elapsed.Seconds()
+}
+
+// ItemIterator is the interface of item sources for BulkLoadIterator, modeled after bufio.Scanner:
+// Next advances to the next item and reports whether there is one, Item returns it, and Err returns
+// the error that stopped the iteration, if any.
+type ItemIterator interface {
+	Next() bool
+	Item() interface{}
+	Err() error
+}
+
+// BulkLoad reads items from the channel until it is closed and loads them into the structure described by opts.
+// Items are batched and pipelined over opts.Workers connections; at most Workers*PipelineDepth batches are
+// buffered at any time, so memory stays bounded however large the input is.
+// A failing batch does not stop the load: its items are counted in Errors and the first such error is returned
+// along with the final statistics. Cancelling ctx stops the load early and returns ctx.Err().
+func (client *Client) BulkLoad(ctx context.Context, opts BulkLoadOptions, items <-chan interface{}) (BulkLoadStats, error) {
+	return client.bulkLoad(ctx, opts, func() (interface{}, bool, error) {
+		select {
+		case item, ok := <-items:
+			return item, ok, nil
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	})
+}
+
+// BulkLoadIterator is like BulkLoad, reading the items from an ItemIterator.
+func (client *Client) BulkLoadIterator(ctx context.Context, opts BulkLoadOptions, it ItemIterator) (BulkLoadStats, error) {
+	return client.bulkLoad(ctx, opts, func() (interface{}, bool, error) {
+		if ctx.Err() != nil {
+			return nil, false, ctx.Err()
+		}
+		if !it.Next() {
+			return nil, false, it.Err()
+		}
+		return it.Item(), true, nil
+	})
+}
+
+// bulkLoader holds the state shared by the producer and the workers of a bulk load
+type bulkLoader struct {
+	// counters come first to keep them 64-bit aligned for sync/atomic
+	items   int64
+	added   int64
+	present int64
+	errors  int64
+
+	client   *Client
+	opts     BulkLoadOptions
+	start    time.Time
+	errOnce  sync.Once
+	firstErr error
+}
+
+func (l *bulkLoader) stats() BulkLoadStats {
+	return BulkLoadStats{
+		Items:   atomic.LoadInt64(&l.items),
+		Added:   atomic.LoadInt64(&l.added),
+		Present: atomic.LoadInt64(&l.present),
+		Errors:  atomic.LoadInt64(&l.errors),
+		Elapsed: time.Since(l.start),
+	}
+}
+
+func (l *bulkLoader) fail(items int, err error) {
+	atomic.AddInt64(&l.errors, int64(items))
+	l.errOnce.Do(func() { l.firstErr = err })
+}
+
+func (client *Client) bulkLoad(ctx context.Context, opts BulkLoadOptions, next func() (interface{}, bool, error)) (BulkLoadStats, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1000
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 4
+	}
+	if opts.PipelineDepth <= 0 {
+		opts.PipelineDepth = 8
+	}
+	if opts.ProgressInterval <= 0 {
+		opts.ProgressInterval = time.Second
+	}
+	switch opts.Target {
+	case BulkBloom, BulkCuckoo, BulkCountMin:
+	default:
+		return BulkLoadStats{}, errors.New("unknown bulk load target")
+	}
+	l := &bulkLoader{client: client, opts: opts, start: time.Now()}
+
+	batches := make(chan redis.Args, opts.Workers*opts.PipelineDepth)
+	var workers sync.WaitGroup
+	for i := 0; i < opts.Workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			l.work(ctx, batches)
+		}()
+	}
+
+	stopProgress := make(chan struct{})
+	var progress sync.WaitGroup
+	if opts.Progress != nil {
+		progress.Add(1)
+		go func() {
+			defer progress.Done()
+			ticker := time.NewTicker(opts.ProgressInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					opts.Progress(l.stats())
+				case <-stopProgress:
+					return
+				}
+			}
+		}()
+	}
+
+	readErr := l.produce(ctx, next, batches)
+	close(batches)
+	workers.Wait()
+	close(stopProgress)
+	progress.Wait()
+
+	stats := l.stats()
+	if opts.Progress != nil {
+		opts.Progress(stats)
+	}
+	if readErr != nil {
+		return stats, readErr
+	}
+	return stats, l.firstErr
+}
+
+// produce reads items until the source is exhausted, batching them into batches. The items read before the
+// source fails are still sent.
+func (l *bulkLoader) produce(ctx context.Context, next func() (interface{}, bool, error), batches chan<- redis.Args) error {
+	batch := make(redis.Args, 0, l.opts.BatchSize)
+	send := func() error {
+		select {
+		case batches <- batch:
+		case <-ctx.Done():
+			l.fail(len(batch), ctx.Err())
+			return ctx.Err()
+		}
+		batch = make(redis.Args, 0, l.opts.BatchSize)
+		return nil
+	}
+	for {
+		item, ok, err := next()
+		if err != nil {
+			if len(batch) > 0 {
+				if sendErr := send(); sendErr != nil {
+					return sendErr
+				}
+			}
+			return err
+		}
+		if !ok {
+			break
+		}
+		atomic.AddInt64(&l.items, 1)
+		encoded, err := l.client.encodeItem(item)
+		if err != nil {
+			l.fail(1, err)
+			continue
+		}
+		batch = append(batch, encoded)
+		if len(batch) == l.opts.BatchSize {
+			if err := send(); err != nil {
+				return err
+			}
+		}
+	}
+	if len(batch) > 0 {
+		return send()
+	}
+	return nil
+}
+
+// work sends batches over a single connection, keeping up to PipelineDepth commands in flight
+func (l *bulkLoader) work(ctx context.Context, batches <-chan redis.Args) {
+	conn := l.client.getConnContext(ctx)
+	defer func() { conn.Close() }()
+	inFlight := make([]redis.Args, 0, l.opts.PipelineDepth)
+	for batch := range batches {
+		inFlight = append(inFlight[:0], batch)
+	fill:
+		for len(inFlight) < l.opts.PipelineDepth {
+			select {
+			case batch, ok := <-batches:
+				if !ok {
+					break fill
+				}
+				inFlight = append(inFlight, batch)
+			default:
+				break fill
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			// drain the queued batches without sending them
+			for _, batch := range inFlight {
+				l.fail(len(batch), err)
+			}
+			continue
+		}
+		cmds := make([]pipelineCmd, len(inFlight))
+		for i, batch := range inFlight {
+			cmds[i] = l.command(batch)
+		}
+		replies, err := doPipeline(conn, cmds)
+		if err != nil {
+			for _, batch := range inFlight {
+				l.fail(len(batch), err)
+			}
+			// the connection may be unusable, start over with a fresh one
+			conn.Close()
+			conn = l.client.getConnContext(ctx)
+			continue
+		}
+		for i, reply := range replies {
+			l.account(inFlight[i], reply)
+		}
+	}
+}
+
+func (l *bulkLoader) command(batch redis.Args) pipelineCmd {
+	key := l.opts.Key
+	switch l.opts.Target {
+	case BulkCuckoo:
+		return pipelineCmd{"CF.INSERTNX", append(redis.Args{key, "ITEMS"}, batch...)}
+	case BulkCountMin:
+		args := make(redis.Args, 0, 1+2*len(batch))
+		args = append(args, key)
+		for _, item := range batch {
+			args = append(args, item, 1)
+		}
+		return pipelineCmd{"CMS.INCRBY", args}
+	}
+	return pipelineCmd{"BF.MADD", append(redis.Args{key}, batch...)}
+}
+
+// account updates the statistics with the reply to a batch
+func (l *bulkLoader) account(batch redis.Args, reply interface{}) {
+	values, err := redis.Values(reply, nil)
+	if err != nil {
+		l.fail(len(batch), err)
+		return
+	}
+	for _, value := range values {
+		n, err := redis.Int64(value, nil)
+		switch {
+		case err != nil:
+			l.fail(1, err)
+		case l.opts.Target == BulkCountMin:
+			atomic.AddInt64(&l.added, 1)
+		case n == 1:
+			atomic.AddInt64(&l.added, 1)
+		case n == 0:
+			atomic.AddInt64(&l.present, 1)
+		default:
+			// CF.INSERTNX answers -1 when the filter is full
+			l.fail(1, errors.New("filter is full"))
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package redis_bloom_go
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/RedisBloom/redisbloom-go/internal/redistest"
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+// sliceIterator is an ItemIterator over a slice, failing with err once exhausted
+type sliceIterator struct {
+	items []interface{}
+	pos   int
+	err   error
+}
+
+func (it *sliceIterator) Next() bool {
+	it.pos++
+	return it.pos <= len(it.items)
+}
+
+func (it *sliceIterator) Item() interface{} {
+	return it.items[it.pos-1]
+}
+
+func (it *sliceIterator) Err() error {
+	return it.err
+}
+
+// madd answers BF.MADD with 0 for items prefixed with "dup" and 1 otherwise
+func madd(cmd string, args []interface{}) (interface{}, error) {
+	if args[0] == "wrongtype" {
+		return redis.Error("WRONGTYPE Operation against a key holding the wrong kind of value"), nil
+	}
+	reply := make([]interface{}, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		if s, _ := redis.String(arg, nil); len(s) >= 3 && s[:3] == "dup" {
+			reply = append(reply, int64(0))
+		} else {
+			reply = append(reply, int64(1))
+		}
+	}
+	return reply, nil
+}
+
+func TestClient_BulkLoadFake(t *testing.T) {
+	pool := &redistest.Pool{Reply: madd}
+	c := &Client{Pool: pool}
+	items := make(chan interface{})
+	go func() {
+		for i := 0; i < 95; i++ {
+			items <- fmt.Sprintf("item%d", i)
+		}
+		for i := 0; i < 5; i++ {
+			items <- fmt.Sprintf("dup%d", i)
+		}
+		items <- struct{}{}
+		close(items)
+	}()
+	progressCalls := 0
+	stats, err := c.BulkLoad(context.Background(), BulkLoadOptions{
+		Key:           "key",
+		BatchSize:     10,
+		Workers:       3,
+		PipelineDepth: 2,
+		Progress:      func(BulkLoadStats) { progressCalls++ },
+	}, items)
+	assert.NotNil(t, err)
+	assert.Equal(t, int64(101), stats.Items)
+	assert.Equal(t, int64(95), stats.Added)
+	assert.Equal(t, int64(5), stats.Present)
+	assert.Equal(t, int64(1), stats.Errors)
+	assert.True(t, stats.Throughput() > 0)
+	assert.True(t, progressCalls >= 1)
+	assert.Equal(t, 10, len(pool.Commands))
+	for _, cmd := range pool.Commands {
+		assert.Equal(t, "BF.MADD", cmd[0])
+	}
+}
+
+func TestClient_BulkLoadIteratorFake(t *testing.T) {
+	pool := &redistest.Pool{Reply: madd}
+	c := &Client{Pool: pool}
+	it := &sliceIterator{items: []interface{}{"a", []byte("b"), "dup"}}
+	stats, err := c.BulkLoadIterator(context.Background(), BulkLoadOptions{Key: "key", BatchSize: 2}, it)
+	assert.Nil(t, err)
+	assert.Equal(t, BulkLoadStats{Items: 3, Added: 2, Present: 1, Elapsed: stats.Elapsed}, stats)
+
+	it = &sliceIterator{items: []interface{}{"a", "b"}}
+	stats, err = c.BulkLoadIterator(context.Background(), BulkLoadOptions{Key: "wrongtype"}, it)
+	assert.NotNil(t, err)
+	assert.Equal(t, int64(2), stats.Errors)
+
+	// the items read before the source fails are still loaded
+	sourceErr := errors.New("source failed")
+	it = &sliceIterator{items: []interface{}{"a", "b", "c"}, err: sourceErr}
+	stats, err = c.BulkLoadIterator(context.Background(), BulkLoadOptions{Key: "key", BatchSize: 2}, it)
+	assert.Equal(t, sourceErr, err)
+	assert.Equal(t, int64(3), stats.Items)
+	assert.Equal(t, int64(3), stats.Added)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = c.BulkLoadIterator(ctx, BulkLoadOptions{Key: "key"}, &sliceIterator{items: []interface{}{"a"}})
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestClient_BulkLoadCancelFake(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	// the first batch cancels the load while the next ones are queued
+	pool := &redistest.Pool{Reply: func(cmd string, args []interface{}) (interface{}, error) {
+		cancel()
+		return madd(cmd, args)
+	}}
+	c := &Client{Pool: pool}
+	items := make([]interface{}, 20)
+	for i := range items {
+		items[i] = fmt.Sprintf("item%d", i)
+	}
+	stats, err := c.BulkLoadIterator(ctx, BulkLoadOptions{Key: "key", BatchSize: 2, Workers: 1, PipelineDepth: 1},
+		&sliceIterator{items: items})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 1, len(pool.Commands))
+	assert.Equal(t, int64(2), stats.Added)
+	assert.True(t, stats.Errors > 0)
+	assert.Equal(t, stats.Items, stats.Added+stats.Present+stats.Errors)
+}
+
+func TestClient_BulkLoad(t *testing.T) {
+	client.FlushAll()
+	targets := []struct {
+		target BulkTarget
+		key    string
+	}{
+		{BulkBloom, "test_bulk_bf"},
+		{BulkCuckoo, "test_bulk_cf"},
+		{BulkCountMin, "test_bulk_cms"},
+	}
+	ret, err := client.CmsInitByDim("test_bulk_cms", 1000, 5)
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", ret)
+	for _, tt := range targets {
+		items := make(chan interface{}, 1000)
+		for i := 0; i < 1000; i++ {
+			items <- fmt.Sprintf("item%d", i%500)
+		}
+		close(items)
+		stats, err := client.BulkLoad(context.Background(), BulkLoadOptions{
+			Target:    tt.target,
+			Key:       tt.key,
+			BatchSize: 100,
+			Workers:   1,
+		}, items)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1000), stats.Items)
+		assert.Equal(t, int64(0), stats.Errors)
+		if tt.target == BulkCountMin {
+			assert.Equal(t, int64(1000), stats.Added)
+		} else {
+			assert.Equal(t, int64(1000), stats.Added+stats.Present)
+			assert.True(t, stats.Present >= 500)
+		}
+	}
+	counts, err := client.CmsQuery("test_bulk_cms", []string{"item0"})
+	assert.Nil(t, err)
+	assert.True(t, counts[0] >= 2)
+	exists, err := client.CfExists("test_bulk_cf", "item499")
+	assert.Nil(t, err)
+	assert.True(t, exists)
+}
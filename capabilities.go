@@ -0,0 +1,252 @@
+package redis_bloom_go
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// moduleCommands are the RedisBloom commands whose support is probed
+var moduleCommands = []string{
+	"BF.ADD", "BF.CARD", "BF.EXISTS", "BF.INFO", "BF.INSERT", "BF.LOADCHUNK", "BF.MADD", "BF.MEXISTS",
+	"BF.RESERVE", "BF.SCANDUMP",
+	"CF.ADD", "CF.ADDNX", "CF.COUNT", "CF.DEL", "CF.EXISTS", "CF.INFO", "CF.INSERT", "CF.INSERTNX",
+	"CF.LOADCHUNK", "CF.MEXISTS", "CF.RESERVE", "CF.SCANDUMP",
+	"CMS.INCRBY", "CMS.INFO", "CMS.INITBYDIM", "CMS.INITBYPROB", "CMS.MERGE", "CMS.QUERY",
+	"TOPK.ADD", "TOPK.COUNT", "TOPK.INCRBY", "TOPK.INFO", "TOPK.LIST", "TOPK.QUERY", "TOPK.RESERVE",
+	"TDIGEST.ADD", "TDIGEST.BYRANK", "TDIGEST.BYREVRANK", "TDIGEST.CDF", "TDIGEST.CREATE", "TDIGEST.INFO",
+	"TDIGEST.MAX", "TDIGEST.MERGE", "TDIGEST.MIN", "TDIGEST.QUANTILE", "TDIGEST.RANK", "TDIGEST.RESET",
+	"TDIGEST.REVRANK", "TDIGEST.TRIMMED_MEAN",
+}
+
+// tdigestSyntaxVersion is the RedisBloom version that introduced the current TDIGEST syntax: COMPRESSION keyword
+// of TDIGEST.CREATE, numkeys of TDIGEST.MERGE and several values per TDIGEST.QUANTILE and TDIGEST.CDF
+const tdigestSyntaxVersion = 20400
+
+// Capabilities is a struct that represents what the server behind a pool supports
+type Capabilities struct {
+	// Version is the version of the RedisBloom module, such as 20403 for 2.4.3, or 0 when it is not loaded
+	Version int64
+	// Modules maps the name of every loaded module to its version
+	Modules map[string]int64
+	// Commands holds the RedisBloom commands known to the server, in upper case
+	Commands map[string]bool
+}
+
+// Supports reports whether the server knows cmd
+func (c *Capabilities) Supports(cmd string) bool {
+	return c.Commands[strings.ToUpper(cmd)]
+}
+
+// legacyTdigest reports whether the server only knows the TDIGEST syntax prior to RedisBloom 2.4
+func (c *Capabilities) legacyTdigest() bool {
+	return c.Version > 0 && c.Version < tdigestSyntaxVersion
+}
+
+// UnsupportedCommandError is returned by the commands the server does not support, when
+// Client.CheckCapabilities is set
+type UnsupportedCommandError struct {
+	Command string
+	Version int64
+}
+
+func (e *UnsupportedCommandError) Error() string {
+	return fmt.Sprintf("%s is not supported by the server (RedisBloom version %d)", e.Command, e.Version)
+}
+
+// capabilitiesProbe holds the outcome of the probe of the capabilities of a client, shared by its copies
+type capabilitiesProbe struct {
+	mu    sync.Mutex
+	state *probedCapabilities
+}
+
+type probedCapabilities struct {
+	once  sync.Once
+	caps  *Capabilities
+	err   error
+	final bool
+}
+
+// capabilitiesProbeMu guards the allocation of Client.capabilities
+var capabilitiesProbeMu sync.Mutex
+
+// capabilitiesProbe returns the probe of client, allocated on first use
+func (client *Client) capabilitiesProbe() *capabilitiesProbe {
+	capabilitiesProbeMu.Lock()
+	defer capabilitiesProbeMu.Unlock()
+	if client.capabilities == nil {
+		client.capabilities = &capabilitiesProbe{}
+	}
+	return client.capabilities
+}
+
+// get returns the probed capabilities, running probe when they are not known yet. Concurrent callers wait for
+// the same probe. A probe whose outcome is not final is run again by the next call.
+func (p *capabilitiesProbe) get(probe func() (*Capabilities, bool, error)) (*Capabilities, error) {
+	p.mu.Lock()
+	if p.state == nil {
+		p.state = &probedCapabilities{}
+	}
+	state := p.state
+	p.mu.Unlock()
+	state.once.Do(func() {
+		state.caps, state.final, state.err = probe()
+	})
+	if !state.final {
+		p.reset(state)
+	}
+	return state.caps, state.err
+}
+
+// reset forgets state, unless it was already replaced by another probe
+func (p *capabilitiesProbe) reset(state *probedCapabilities) {
+	p.mu.Lock()
+	if p.state == state {
+		p.state = nil
+	}
+	p.mu.Unlock()
+}
+
+// errNotProbed is the outcome of checkedCapabilities before the capabilities were probed
+var errNotProbed = errors.New("capabilities not probed")
+
+// Capabilities returns the capabilities of the server, probed with MODULE LIST and COMMAND INFO the first time
+// they are needed by client or one of its copies, such as those made by WithContext. With a MultiHostPool, all the
+// hosts are assumed to run the same version. A probe the server rejects, for instance because of ACLs, is not
+// retried; one that failed to reach it is.
+func (client *Client) Capabilities() (*Capabilities, error) {
+	return client.capabilitiesProbe().get(func() (*Capabilities, bool, error) {
+		// the probe bypasses the hooks, which may depend on the capabilities
+		conn := client.Pool.Get()
+		defer conn.Close()
+		return probeCapabilities(conn)
+	})
+}
+
+// ResetCapabilities forgets the capabilities probed for client and its copies, so they are probed again when
+// next needed, for instance after the server was upgraded
+func (client *Client) ResetCapabilities() {
+	p := client.capabilitiesProbe()
+	p.mu.Lock()
+	p.state = nil
+	p.mu.Unlock()
+}
+
+// probeConn probes the capabilities on conn, a connection of client.Pool not wrapped by the hooks, unless they
+// are known already. It is called when client.CheckCapabilities is set, before conn runs its first command.
+func (client *Client) probeConn(conn redis.Conn) {
+	client.capabilitiesProbe().get(func() (*Capabilities, bool, error) {
+		return probeCapabilities(conn)
+	})
+}
+
+// checkedCapabilities returns the capabilities of the server when client.CheckCapabilities is set, nil otherwise
+// or when they could not be probed. It never probes itself: the connections of client probe the capabilities
+// when they are created, see hookConn.
+func (client *Client) checkedCapabilities() *Capabilities {
+	if !client.CheckCapabilities {
+		return nil
+	}
+	caps, err := client.capabilitiesProbe().get(func() (*Capabilities, bool, error) {
+		return nil, false, errNotProbed
+	})
+	if err != nil {
+		return nil
+	}
+	return caps
+}
+
+// probeCapabilities queries the capabilities of the server on conn; final is false when the server could not be
+// reached
+func probeCapabilities(conn redis.Conn) (caps *Capabilities, final bool, err error) {
+	replies, err := doPipeline(conn, []pipelineCmd{
+		{"MODULE", redis.Args{"LIST"}},
+		{"COMMAND", redis.Args{"INFO"}.AddFlat(moduleCommands)},
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	caps = &Capabilities{Modules: map[string]int64{}, Commands: map[string]bool{}}
+	modules, err := redis.Values(replies[0], nil)
+	if err != nil {
+		return nil, true, fmt.Errorf("MODULE LIST: %v", err)
+	}
+	for _, module := range modules {
+		fields, err := replyPairs(module, nil)
+		if err != nil || len(fields)%2 != 0 {
+			return nil, true, fmt.Errorf("MODULE LIST: unexpected module description %v", module)
+		}
+		var name string
+		var version int64
+		for i := 0; i < len(fields); i += 2 {
+			field, _ := redis.String(fields[i], nil)
+			switch field {
+			case "name":
+				name, err = redis.String(fields[i+1], nil)
+			case "ver":
+				version, err = redis.Int64(fields[i+1], nil)
+			}
+			if err != nil {
+				return nil, true, fmt.Errorf("MODULE LIST: invalid %s: %v", field, err)
+			}
+		}
+		caps.Modules[name] = version
+	}
+	caps.Version = caps.Modules["bf"]
+
+	infos, err := redis.Values(replies[1], nil)
+	if err != nil {
+		return nil, true, fmt.Errorf("COMMAND INFO: %v", err)
+	}
+	if len(infos) != len(moduleCommands) {
+		return nil, true, fmt.Errorf("COMMAND INFO: expects %d values result, got %d", len(moduleCommands), len(infos))
+	}
+	for i, info := range infos {
+		if info != nil {
+			caps.Commands[moduleCommands[i]] = true
+		}
+	}
+	return caps, true, nil
+}
+
+// capabilityCheck is a Hook failing the RedisBloom commands the server does not know before they are sent
+type capabilityCheck struct {
+	client *Client
+}
+
+func (h capabilityCheck) BeforeProcess(ctx context.Context, cmd *Command) (context.Context, error) {
+	if cmd.Family() == "REDIS" {
+		return ctx, nil
+	}
+	caps := h.client.checkedCapabilities()
+	if caps == nil || caps.Supports(cmd.Name) || !isProbedCommand(cmd.Name) {
+		return ctx, nil
+	}
+	return ctx, &UnsupportedCommandError{Command: strings.ToUpper(cmd.Name), Version: caps.Version}
+}
+
+func (h capabilityCheck) AfterProcess(ctx context.Context, cmd *Command) error {
+	return cmd.Err
+}
+
+func (h capabilityCheck) BeforeProcessPipeline(ctx context.Context, cmds []*Command) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h capabilityCheck) AfterProcessPipeline(ctx context.Context, cmds []*Command) error {
+	return nil
+}
+
+func isProbedCommand(cmd string) bool {
+	cmd = strings.ToUpper(cmd)
+	for _, probed := range moduleCommands {
+		if probed == cmd {
+			return true
+		}
+	}
+	return false
+}
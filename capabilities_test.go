@@ -0,0 +1,166 @@
+package redis_bloom_go
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RedisBloom/redisbloom-go/internal/redistest"
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+// legacyServer answers like a RedisBloom 2.2 server, which has neither BF.CARD nor the TDIGEST rank commands
+func legacyServer(cmd string, args []interface{}) (interface{}, error) {
+	switch cmd {
+	case "MODULE":
+		return []interface{}{[]interface{}{"name", "bf", "ver", int64(20206)}}, nil
+	case "COMMAND":
+		infos := make([]interface{}, len(args)-1)
+		for i, name := range args[1:] {
+			switch name {
+			case "BF.CARD", "TDIGEST.RANK", "TDIGEST.REVRANK", "TDIGEST.BYRANK", "TDIGEST.BYREVRANK",
+				"TDIGEST.TRIMMED_MEAN":
+			default:
+				infos[i] = []interface{}{name}
+			}
+		}
+		return infos, nil
+	case "BF.INFO":
+		return []interface{}{"Capacity", int64(100), "Number of items inserted", int64(7)}, nil
+	case "TDIGEST.QUANTILE", "TDIGEST.CDF":
+		return []byte(args[1].(string)), nil
+	}
+	return "OK", nil
+}
+
+func TestClient_Capabilities(t *testing.T) {
+	pool := &redistest.Pool{Reply: legacyServer}
+	client := &Client{Pool: pool}
+	caps, err := client.Capabilities()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(20206), caps.Version)
+	assert.Equal(t, map[string]int64{"bf": 20206}, caps.Modules)
+	assert.True(t, caps.Supports("bf.add"))
+	assert.False(t, caps.Supports("BF.CARD"))
+	assert.True(t, caps.legacyTdigest())
+
+	// probed once per client, and shared with its copies
+	_, err = client.WithContext(context.Background()).Capabilities()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(pool.Commands))
+
+	// probed again once reset
+	client.WithContext(context.Background()).ResetCapabilities()
+	_, err = client.Capabilities()
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(pool.Commands))
+}
+
+// valuePool is a ConnPool that is not comparable
+type valuePool struct {
+	get func() redis.Conn
+}
+
+func (p valuePool) Get() redis.Conn {
+	return p.get()
+}
+
+func (p valuePool) Close() error {
+	return nil
+}
+
+func TestClient_CheckCapabilitiesProbesOnce(t *testing.T) {
+	pool := &redistest.Pool{Reply: legacyServer}
+	client := &Client{Pool: valuePool{pool.Get}, CheckCapabilities: true}
+	for i := 0; i < 3; i++ {
+		_, err := client.TdCreate("td", 100)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, 1, len(pool.Sent("MODULE")))
+	// the probe runs on the connection of the command, so a pool of one connection does not deadlock
+	assert.Equal(t, 3, pool.Conns)
+}
+
+func TestClient_CheckCapabilitiesSingleConnection(t *testing.T) {
+	fake := &redistest.Pool{Reply: legacyServer}
+	pool := &redis.Pool{MaxActive: 1, Wait: true, Dial: func() (redis.Conn, error) { return fake.Get(), nil }}
+	defer pool.Close()
+	client := &Client{Pool: pool, CheckCapabilities: true}
+	done := make(chan error)
+	go func() {
+		_, err := client.TdRank("td", 1)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		assert.Equal(t, &UnsupportedCommandError{Command: "TDIGEST.RANK", Version: 20206}, err)
+	case <-time.After(time.Second):
+		t.Fatal("the capability probe waits for a second connection")
+	}
+}
+
+func TestClient_CheckCapabilities(t *testing.T) {
+	pool := &redistest.Pool{Reply: legacyServer}
+	client := &Client{Pool: pool, CheckCapabilities: true}
+
+	_, err := client.TdRank("td", 1)
+	assert.Equal(t, &UnsupportedCommandError{Command: "TDIGEST.RANK", Version: 20206}, err)
+	assert.Equal(t, "TDIGEST.RANK is not supported by the server (RedisBloom version 20206)", err.Error())
+
+	// fallbacks to the older syntax
+	pool.Commands = nil
+	card, err := client.BfCard("bf")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(7), card)
+	_, err = client.TdCreate("td", 100)
+	assert.Nil(t, err)
+	_, err = client.TdMerge("td", 2, "a", "b")
+	assert.Nil(t, err)
+	_, err = client.TdMergeWithOverride("td", true, 1, "a")
+	assert.NotNil(t, err)
+	quantiles, err := client.TdQuantiles("td", 0.5, 0.9)
+	assert.Nil(t, err)
+	assert.Equal(t, []float64{0.5, 0.9}, quantiles)
+	_, err = client.TdAddValues("td", []float64{1, 2})
+	assert.Nil(t, err)
+	multi, err := client.TdQuantilesMulti([]string{"a", "b"}, 0.5)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]float64{"a": {0.5}, "b": {0.5}}, multi)
+	assert.Equal(t, [][]interface{}{
+		{"BF.INFO", "bf"},
+		{"TDIGEST.CREATE", "td", int64(100)},
+		{"TDIGEST.MERGE", "td", "a"},
+		{"TDIGEST.MERGE", "td", "b"},
+		{"TDIGEST.QUANTILE", "td", "0.5"},
+		{"TDIGEST.QUANTILE", "td", "0.9"},
+		{"TDIGEST.ADD", "td", "1", 1, "2", 1},
+		{"TDIGEST.QUANTILE", "a", "0.5"},
+		{"TDIGEST.QUANTILE", "b", "0.5"},
+	}, pool.Commands)
+}
+
+func TestClient_CheckCapabilitiesDisabled(t *testing.T) {
+	pool := &redistest.Pool{Reply: legacyServer}
+	client := &Client{Pool: pool}
+	_, err := client.TdCreate("td", 100)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]interface{}{{"TDIGEST.CREATE", "td", "COMPRESSION", int64(100)}}, pool.Commands)
+}
+
+func TestClient_CapabilitiesRejected(t *testing.T) {
+	pool := &redistest.Pool{Reply: func(cmd string, args []interface{}) (interface{}, error) {
+		if cmd == "MODULE" {
+			return redis.Error("NOPERM this user has no permissions to run the 'module' command"), nil
+		}
+		return legacyServer(cmd, args)
+	}}
+	client := &Client{Pool: pool, CheckCapabilities: true}
+	_, err := client.Capabilities()
+	assert.NotNil(t, err)
+
+	// commands run unchecked, without probing again
+	_, err = client.TdReset("td")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(pool.Commands))
+}
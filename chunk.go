@@ -0,0 +1,94 @@
+package redis_bloom_go
+
+import (
+	"sync"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// ChunkOptions configures how the multi-item commands split very large item lists.
+// It applies to BfAddMulti, BfExistsMulti, BfInsert, CfInsert, CfInsertNx, CmsQuery, TopkAdd and
+// TopkAddWithExpelled, as well as to their *Items variants.
+//
+// Chunking gives up the atomicity of a single command: the chunks are applied independently, so when one of
+// them fails the write commands return its error while the items of the other chunks may already be added.
+type ChunkOptions struct {
+	// MaxItems is the maximum number of items sent in a single command. Zero disables chunking.
+	MaxItems int
+	// Parallelism is the number of connections the chunks are spread over. With a value below 2 all the
+	// chunks are pipelined over a single connection, in order. Otherwise the chunks run concurrently, so the
+	// order in which the server applies them is not defined; this matters for TopkAdd expulsions only.
+	Parallelism int
+}
+
+// doChunked runs cmd with prefix followed by items and returns the array reply.
+// When items exceed client.Chunking.MaxItems they are split over several commands that repeat prefix,
+// and the array replies of all commands are concatenated back in input order.
+func (client *Client) doChunked(cmd string, prefix redis.Args, items redis.Args) ([]interface{}, error) {
+	maxItems := client.Chunking.MaxItems
+	if maxItems <= 0 || len(items) <= maxItems {
+		conn := client.getConn()
+		defer conn.Close()
+		return redis.Values(conn.Do(cmd, append(prefix, items...)...))
+	}
+
+	cmds := make([]pipelineCmd, 0, len(items)/maxItems+1)
+	for start := 0; start < len(items); start += maxItems {
+		end := start + maxItems
+		if end > len(items) {
+			end = len(items)
+		}
+		args := make(redis.Args, 0, len(prefix)+end-start)
+		cmds = append(cmds, pipelineCmd{cmd, append(append(args, prefix...), items[start:end]...)})
+	}
+
+	parallelism := client.Chunking.Parallelism
+	if parallelism > len(cmds) {
+		parallelism = len(cmds)
+	}
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	replies := make([]interface{}, len(cmds))
+	errs := make([]error, parallelism)
+	var wg sync.WaitGroup
+	perConn := (len(cmds) + parallelism - 1) / parallelism
+	for worker := 0; worker < parallelism; worker++ {
+		start := worker * perConn
+		end := start + perConn
+		if end > len(cmds) {
+			end = len(cmds)
+		}
+		if start >= end {
+			break
+		}
+		wg.Add(1)
+		go func(worker, start, end int) {
+			defer wg.Done()
+			conn := client.getConn()
+			defer conn.Close()
+			chunkReplies, err := doPipeline(conn, cmds[start:end])
+			if err != nil {
+				errs[worker] = err
+				return
+			}
+			copy(replies[start:end], chunkReplies)
+		}(worker, start, end)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result := make([]interface{}, 0, len(items))
+	for _, reply := range replies {
+		values, err := redis.Values(reply, nil)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, values...)
+	}
+	return result, nil
+}
@@ -0,0 +1,83 @@
+package redis_bloom_go
+
+import (
+	"testing"
+
+	"github.com/RedisBloom/redisbloom-go/internal/redistest"
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+// echoItems answers every command with the items following the key, as a []interface{} of []byte
+func echoItems(cmd string, args []interface{}) (interface{}, error) {
+	reply := make([]interface{}, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		reply = append(reply, []byte(arg.(string)))
+	}
+	return reply, nil
+}
+
+func TestClient_doChunked(t *testing.T) {
+	items := redis.Args{"a", "b", "c", "d", "e"}
+	tests := []struct {
+		name         string
+		chunking     ChunkOptions
+		wantCommands int
+	}{
+		{"disabled", ChunkOptions{}, 1},
+		{"larger than input", ChunkOptions{MaxItems: 10}, 1},
+		{"pipelined", ChunkOptions{MaxItems: 2}, 3},
+		{"parallel", ChunkOptions{MaxItems: 2, Parallelism: 2}, 3},
+		{"more connections than chunks", ChunkOptions{MaxItems: 1, Parallelism: 10}, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := &redistest.Pool{Reply: echoItems}
+			c := &Client{Pool: pool, Chunking: tt.chunking}
+			got, err := redis.Strings(c.doChunked("TOPK.ADD", redis.Args{"key"}, items))
+			assert.Nil(t, err)
+			assert.Equal(t, []string{"a", "b", "c", "d", "e"}, got)
+			assert.Equal(t, tt.wantCommands, len(pool.Commands))
+			for _, cmd := range pool.Commands {
+				assert.Equal(t, "TOPK.ADD", cmd[0])
+				assert.Equal(t, "key", cmd[1])
+				if tt.chunking.MaxItems > 0 {
+					assert.True(t, len(cmd)-2 <= tt.chunking.MaxItems)
+				}
+			}
+		})
+	}
+}
+
+func TestClient_doChunkedServerError(t *testing.T) {
+	pool := &redistest.Pool{Reply: func(cmd string, args []interface{}) (interface{}, error) {
+		if args[1] == "c" {
+			return redis.Error("WRONGTYPE Operation against a key holding the wrong kind of value"), nil
+		}
+		return echoItems(cmd, args)
+	}}
+	c := &Client{Pool: pool, Chunking: ChunkOptions{MaxItems: 2}}
+	_, err := c.doChunked("BF.MADD", redis.Args{"key"}, redis.Args{"a", "b", "c", "d"})
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, len(pool.Commands))
+}
+
+func TestClient_BfAddMultiChunked(t *testing.T) {
+	client.FlushAll()
+	defer func(chunking ChunkOptions) { client.Chunking = chunking }(client.Chunking)
+	key := "test_bf_madd_chunked"
+	items := []string{"a", "b", "c", "d", "e", "a"}
+	for _, chunking := range []ChunkOptions{{MaxItems: 2}, {MaxItems: 2, Parallelism: 3}} {
+		client.FlushAll()
+		client.Chunking = chunking
+		ret, err := client.BfAddMulti(key, items)
+		assert.Nil(t, err)
+		assert.Equal(t, []int64{1, 1, 1, 1, 1, 0}, ret)
+		ret, err = client.BfExistsMulti(key, []string{"a", "z", "e"})
+		assert.Nil(t, err)
+		assert.Equal(t, []int64{1, 0, 1}, ret)
+		ret, err = client.BfInsert(key, 0, 0, 0, false, false, []string{"f", "g", "a"})
+		assert.Nil(t, err)
+		assert.Equal(t, []int64{1, 1, 0}, ret)
+	}
+}
@@ -1,8 +1,10 @@
 package redis_bloom_go
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 
@@ -13,10 +15,33 @@ import (
 // Client Max Connections
 var maxConns = 500
 
+// tdAddBatchSize is the maximum number of observations sent in a single TDIGEST.ADD by TdAddValues
+var tdAddBatchSize = 10000
+
 // Client is an interface to RedisBloom redis commands
 type Client struct {
 	Pool ConnPool
 	Name string
+	// TopkExpelledHandler, when set, is called for every item expelled from a Top-K by TopkAddWithExpelled,
+	// TopkIncrByWithExpelled, TopkAddItems or TopkIncrByItems, in reply order and before the call returns
+	TopkExpelledHandler func(key string, result TopkAddResult)
+	// ItemCodec, when set, encodes every item given to the *Item and *Items methods
+	ItemCodec ItemCodec
+	// Chunking configures how very large multi-item commands are split
+	Chunking ChunkOptions
+	// Hooks run around every command, in order; see Hook, and the instrumentation packages for tracing, logging
+	// and metrics hooks
+	Hooks []Hook
+	// CheckCapabilities probes the server once per client, see Capabilities. RedisBloom commands it does not
+	// support then fail early with an UnsupportedCommandError, and methods fall back to older syntax where one
+	// exists: TdCreate, TdMerge*, TdAddValues, TdQuantiles, TdQuantilesMulti and TdCdf before RedisBloom 2.4, and
+	// BfCard without BF.CARD.
+	CheckCapabilities bool
+
+	// ctx is the context of the commands, set by WithContext
+	ctx context.Context
+	// capabilities holds the probed capabilities, see capabilitiesProbe
+	capabilities *capabilitiesProbe
 }
 
 // TDigestInfo is a struct that represents T-Digest properties
@@ -65,6 +90,53 @@ func (info *TDigestInfo) TotalCompressions() int64 {
 	return info.totalCompressions
 }
 
+// TdRankOutOfRange is the rank reported by TdRank and TdRevRank for a value outside the
+// range of observations, and TdRankEmptySketch the one reported when the sketch is empty
+const (
+	TdRankOutOfRange  int64 = -1
+	TdRankEmptySketch int64 = -2
+)
+
+// TopkItem is a struct that represents one entry of a Top-K list
+type TopkItem struct {
+	// Item is the name of the tracked item
+	Item string
+	// Count is the estimated count of the item
+	Count int64
+	// Rank is the 1-based position of the item in the list; tied counts share a rank
+	Rank int64
+}
+
+// TopkAddResult is a struct that represents the outcome of adding or incrementing one item of a Top-K
+type TopkAddResult struct {
+	// Item is the item that was added or incremented
+	Item string
+	// Expelled reports whether an item was dropped from the Top-K list to make room
+	Expelled bool
+	// ExpelledItem is the dropped item; only meaningful when Expelled is true
+	ExpelledItem string
+}
+
+// TopkIncrement is a struct that represents an increment of a single Top-K item
+type TopkIncrement struct {
+	Item      string
+	Increment int64
+}
+
+// TopkExpelledEvent is a struct that represents an expulsion from the Top-K stored at Key
+type TopkExpelledEvent struct {
+	Key string
+	TopkAddResult
+}
+
+// TopkExpelledChannel returns a handler, suitable for Client.TopkExpelledHandler, that sends
+// every expulsion to ch. Sends block, so ch must be drained for commands to make progress.
+func TopkExpelledChannel(ch chan<- TopkExpelledEvent) func(key string, result TopkAddResult) {
+	return func(key string, result TopkAddResult) {
+		ch <- TopkExpelledEvent{Key: key, TopkAddResult: result}
+	}
+}
+
 // NewClient creates a new client connecting to the redis host, and using the given name as key prefix.
 // Addr can be a single host:port pair, or a comma separated list of host:port,host:port...
 // In the case of multiple hosts we create a multi-pool and select connections at random
@@ -99,7 +171,7 @@ func NewClientFromPool(pool *redis.Pool, name string) *Client {
 // error_rate - the desired probability for false positives
 // capacity - the number of entries you intend to add to the filter
 func (client *Client) Reserve(key string, error_rate float64, capacity uint64) (err error) {
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
 	_, err = conn.Do("BF.RESERVE", key, strconv.FormatFloat(error_rate, 'g', 16, 64), capacity)
 	return err
@@ -110,7 +182,7 @@ func (client *Client) Reserve(key string, error_rate float64, capacity uint64) (
 // key - the name of the filter
 // item - the item to add
 func (client *Client) Add(key string, item string) (exists bool, err error) {
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
 	return redis.Bool(conn.Do("BF.ADD", key, item))
 }
@@ -120,7 +192,7 @@ func (client *Client) Add(key string, item string) (exists bool, err error) {
 // key - the name of the filter
 // item - the item to check for
 func (client *Client) Exists(key string, item string) (exists bool, err error) {
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
 	return redis.Bool(conn.Do("BF.EXISTS", key, item))
 }
@@ -129,49 +201,36 @@ func (client *Client) Exists(key string, item string) (exists bool, err error) {
 // args:
 // key - the name of the filter
 func (client *Client) Info(key string) (info map[string]int64, err error) {
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
-	result, err := conn.Do("BF.INFO", key)
-	if err != nil {
-		return nil, err
-	}
-
-	values, err := redis.Values(result, nil)
-	if err != nil {
-		return nil, err
-	}
-	if len(values)%2 != 0 {
-		return nil, errors.New("Info expects even number of values result")
-	}
-	info = map[string]int64{}
-	for i := 0; i < len(values); i += 2 {
-		key, err = redis.String(values[i], nil)
-		if err != nil {
-			return nil, err
-		}
-		info[key], err = redis.Int64(values[i+1], nil)
-		if err != nil {
-			return nil, err
-		}
-	}
-	return info, nil
+	return replyDecoder{"BF.INFO"}.info(conn.Do("BF.INFO", key))
 }
 
 // BfAddMulti - Adds one or more items to the Bloom Filter, creating the filter if it does not yet exist.
 // args:
 // key - the name of the filter
 // item - One or more items to add
+// Large item lists are chunked as configured by client.Chunking, see ChunkOptions: on error, the items of the
+// chunks already applied remain added.
 func (client *Client) BfAddMulti(key string, items []string) ([]int64, error) {
-	conn := client.Pool.Get()
-	defer conn.Close()
-	args := redis.Args{key}.AddFlat(items)
-	result, err := conn.Do("BF.MADD", args...)
+	result, err := client.doChunked("BF.MADD", redis.Args{key}, redis.Args{}.AddFlat(items))
 	return redis.Int64s(result, err)
 }
 
 func (client *Client) BfCard(key string) (int64, error) {
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
+	if caps := client.checkedCapabilities(); caps != nil && !caps.Supports("BF.CARD") {
+		// BF.CARD counts a missing filter as empty, BF.INFO fails
+		info, err := replyDecoder{"BF.INFO"}.info(conn.Do("BF.INFO", key))
+		if serverErr, ok := err.(redis.Error); ok && strings.Contains(string(serverErr), "not found") {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		return info["Number of items inserted"], nil
+	}
 	args := redis.Args{key}
 	result, err := conn.Do("BF.CARD", args...)
 	return redis.Int64(result, err)
@@ -181,40 +240,50 @@ func (client *Client) BfCard(key string) (int64, error) {
 // args:
 // key - the name of the filter
 // item - one or more items to check
+// Large item lists are chunked as configured by client.Chunking, see ChunkOptions.
 func (client *Client) BfExistsMulti(key string, items []string) ([]int64, error) {
-	conn := client.Pool.Get()
-	defer conn.Close()
-	args := redis.Args{key}.AddFlat(items)
-	result, err := conn.Do("BF.MEXISTS", args...)
+	result, err := client.doChunked("BF.MEXISTS", redis.Args{key}, redis.Args{}.AddFlat(items))
 	return redis.Int64s(result, err)
 }
 
 // Begins an incremental save of the bloom filter.
 func (client *Client) BfScanDump(key string, iter int64) (int64, []byte, error) {
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
-	reply, err := redis.Values(conn.Do("BF.SCANDUMP", key, iter))
-	if err != nil || len(reply) != 2 {
-		return 0, nil, err
-	}
-	iter = reply[0].(int64)
-	if reply[1] == nil {
-		return iter, nil, err
-	}
-	return iter, reply[1].([]byte), err
+	return replyDecoder{"BF.SCANDUMP"}.scanDump(conn.Do("BF.SCANDUMP", key, iter))
 }
 
 // Restores a filter previously saved using SCANDUMP .
 func (client *Client) BfLoadChunk(key string, iter int64, data []byte) (string, error) {
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
 	return redis.String(conn.Do("BF.LOADCHUNK", key, iter, data))
 }
 
 // This command will add one or more items to the bloom filter, by default creating it if it does not yet exist.
+// Large item lists are chunked as configured by client.Chunking, see ChunkOptions: on error, the items of the
+// chunks already applied remain added.
 func (client *Client) BfInsert(key string, cap int64, errorRatio float64, expansion int64, noCreate bool, nonScaling bool, items []string) (res []int64, err error) {
-	conn := client.Pool.Get()
-	defer conn.Close()
+	args := getBfInsertArgs(key, cap, errorRatio, expansion, noCreate, nonScaling)
+	var resp []interface{}
+	var innerRes int64
+	resp, err = client.doChunked("BF.INSERT", args, redis.Args{}.AddFlat(items))
+	if err != nil {
+		return
+	}
+	for _, arrayPos := range resp {
+		innerRes, err = redis.Int64(arrayPos, err)
+		if err == nil {
+			res = append(res, innerRes)
+		} else {
+			break
+		}
+	}
+	return
+}
+
+// getBfInsertArgs returns the BF.INSERT arguments up to and including the ITEMS keyword
+func getBfInsertArgs(key string, cap int64, errorRatio float64, expansion int64, noCreate bool, nonScaling bool) redis.Args {
 	args := redis.Args{key}
 	if cap > 0 {
 		args = args.Add("CAPACITY", cap)
@@ -231,44 +300,28 @@ func (client *Client) BfInsert(key string, cap int64, errorRatio float64, expans
 	if nonScaling {
 		args = args.Add("NONSCALING")
 	}
-	args = args.Add("ITEMS").AddFlat(items)
-	var resp []interface{}
-	var innerRes int64
-	resp, err = redis.Values(conn.Do("BF.INSERT", args...))
-	if err != nil {
-		return
-	}
-	for _, arrayPos := range resp {
-		innerRes, err = redis.Int64(arrayPos, err)
-		if err == nil {
-			res = append(res, innerRes)
-		} else {
-			break
-		}
-	}
-	return
+	return args.Add("ITEMS")
 }
 
 // Initializes a TopK with specified parameters.
 func (client *Client) TopkReserve(key string, topk int64, width int64, depth int64, decay float64) (string, error) {
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
 	result, err := conn.Do("TOPK.RESERVE", key, topk, width, depth, strconv.FormatFloat(decay, 'g', 16, 64))
 	return redis.String(result, err)
 }
 
 // Adds an item to the data structure.
+// Large item lists are chunked as configured by client.Chunking, see ChunkOptions: on error, the items of the
+// chunks already applied remain added.
 func (client *Client) TopkAdd(key string, items []string) ([]string, error) {
-	conn := client.Pool.Get()
-	defer conn.Close()
-	args := redis.Args{key}.AddFlat(items)
-	result, err := conn.Do("TOPK.ADD", args...)
+	result, err := client.doChunked("TOPK.ADD", redis.Args{key}, redis.Args{}.AddFlat(items))
 	return redis.Strings(result, err)
 }
 
 // Returns count for an item.
 func (client *Client) TopkCount(key string, items []string) (result []int64, err error) {
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
 	args := redis.Args{key}.AddFlat(items)
 	result, err = redis.Int64s(conn.Do("TOPK.COUNT", args...))
@@ -277,7 +330,7 @@ func (client *Client) TopkCount(key string, items []string) (result []int64, err
 
 // Checks whether an item is one of Top-K items.
 func (client *Client) TopkQuery(key string, items []string) ([]int64, error) {
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
 	args := redis.Args{key}.AddFlat(items)
 	result, err := conn.Do("TOPK.QUERY", args...)
@@ -286,50 +339,37 @@ func (client *Client) TopkQuery(key string, items []string) ([]int64, error) {
 
 // Return full list of items in Top K list.
 func (client *Client) TopkListWithCount(key string) (map[string]int64, error) {
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
-	return ParseInfoReply(redis.Values(conn.Do("TOPK.LIST", key, "WITHCOUNT")))
+	return replyDecoder{"TOPK.LIST"}.info(conn.Do("TOPK.LIST", key, "WITHCOUNT"))
 }
 
 func (client *Client) TopkList(key string) ([]string, error) {
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
 	result, err := conn.Do("TOPK.LIST", key)
 	return redis.Strings(result, err)
 }
 
+// TopkListRanked - Return full list of items in Top K list with their counts, preserving the
+// order in which the server ranks them (highest count first).
+// Items sharing the same count share the same rank, so a tie at the top yields two items of rank 1.
+func (client *Client) TopkListRanked(key string) ([]TopkItem, error) {
+	conn := client.getConn()
+	defer conn.Close()
+	return ParseTopkListWithCount(redis.Values(conn.Do("TOPK.LIST", key, "WITHCOUNT")))
+}
+
 // Returns number of required items (k), width, depth and decay values.
 func (client *Client) TopkInfo(key string) (map[string]string, error) {
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
-	reply, err := conn.Do("TOPK.INFO", key)
-	values, err := redis.Values(reply, err)
-	if err != nil {
-		return nil, err
-	}
-	if len(values)%2 != 0 {
-		return nil, errors.New("expects even number of values result")
-	}
-
-	m := make(map[string]string, len(values)/2)
-	for i := 0; i < len(values); i += 2 {
-		k := values[i].(string)
-		switch v := values[i+1].(type) {
-		case []byte:
-			m[k] = string(values[i+1].([]byte))
-			break
-		case int64:
-			m[k] = strconv.FormatInt(values[i+1].(int64), 10)
-		default:
-			return nil, fmt.Errorf("unexpected element type for (Ints,String), got type %T", v)
-		}
-	}
-	return m, err
+	return replyDecoder{"TOPK.INFO"}.topkInfo(conn.Do("TOPK.INFO", key))
 }
 
 // Increase the score of an item in the data structure by increment.
 func (client *Client) TopkIncrBy(key string, itemIncrements map[string]int64) ([]string, error) {
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
 	args := redis.Args{key}
 	for k, v := range itemIncrements {
@@ -339,9 +379,52 @@ func (client *Client) TopkIncrBy(key string, itemIncrements map[string]int64) ([
 	return redis.Strings(reply, err)
 }
 
+// TopkAddWithExpelled - Adds items to the data structure, reporting for every item whether another
+// item was expelled from the list and which one. Unlike TopkAdd, an expelled item named "" is
+// distinguishable from no expulsion at all.
+// Large item lists are chunked as configured by client.Chunking, see ChunkOptions: on error, the items of the
+// chunks already applied remain added.
+func (client *Client) TopkAddWithExpelled(key string, items []string) ([]TopkAddResult, error) {
+	values, err := client.doChunked("TOPK.ADD", redis.Args{key}, redis.Args{}.AddFlat(items))
+	if err != nil {
+		return nil, err
+	}
+	return client.topkExpelled(key, items, values)
+}
+
+// TopkIncrByWithExpelled - Increase the score of items in the data structure, reporting for every
+// increment whether another item was expelled from the list and which one.
+// The results follow the order of increments.
+func (client *Client) TopkIncrByWithExpelled(key string, increments []TopkIncrement) ([]TopkAddResult, error) {
+	conn := client.getConn()
+	defer conn.Close()
+	args := redis.Args{key}
+	items := make([]string, len(increments))
+	for i, incr := range increments {
+		args = args.Add(incr.Item, incr.Increment)
+		items[i] = incr.Item
+	}
+	values, err := redis.Values(conn.Do("TOPK.INCRBY", args...))
+	if err != nil {
+		return nil, err
+	}
+	return client.topkExpelled(key, items, values)
+}
+
+func (client *Client) notifyTopkExpelled(key string, results []TopkAddResult) {
+	if client.TopkExpelledHandler == nil {
+		return
+	}
+	for _, result := range results {
+		if result.Expelled {
+			client.TopkExpelledHandler(key, result)
+		}
+	}
+}
+
 // Initializes a Count-Min Sketch to dimensions specified by user.
 func (client *Client) CmsInitByDim(key string, width int64, depth int64) (string, error) {
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
 	result, err := conn.Do("CMS.INITBYDIM", key, width, depth)
 	return redis.String(result, err)
@@ -349,7 +432,7 @@ func (client *Client) CmsInitByDim(key string, width int64, depth int64) (string
 
 // Initializes a Count-Min Sketch to accommodate requested capacity.
 func (client *Client) CmsInitByProb(key string, error float64, probability float64) (string, error) {
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
 	result, err := conn.Do("CMS.INITBYPROB", key, error, probability)
 	return redis.String(result, err)
@@ -357,7 +440,7 @@ func (client *Client) CmsInitByProb(key string, error float64, probability float
 
 // Increases the count of item by increment. Multiple items can be increased with one call.
 func (client *Client) CmsIncrBy(key string, itemIncrements map[string]int64) ([]int64, error) {
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
 	args := redis.Args{key}
 	for k, v := range itemIncrements {
@@ -368,18 +451,16 @@ func (client *Client) CmsIncrBy(key string, itemIncrements map[string]int64) ([]
 }
 
 // Returns count for item.
+// Large item lists are chunked as configured by client.Chunking, see ChunkOptions.
 func (client *Client) CmsQuery(key string, items []string) ([]int64, error) {
-	conn := client.Pool.Get()
-	defer conn.Close()
-	args := redis.Args{key}.AddFlat(items)
-	result, err := conn.Do("CMS.QUERY", args...)
+	result, err := client.doChunked("CMS.QUERY", redis.Args{key}, redis.Args{}.AddFlat(items))
 	return redis.Int64s(result, err)
 }
 
 // Merges several sketches into one sketch, stored at dest key
 // All sketches must have identical width and depth.
 func (client *Client) CmsMerge(dest string, srcs []string, weights []int64) (string, error) {
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
 	args := redis.Args{dest}.Add(len(srcs)).AddFlat(srcs)
 	if weights != nil && len(weights) > 0 {
@@ -390,14 +471,14 @@ func (client *Client) CmsMerge(dest string, srcs []string, weights []int64) (str
 
 // Returns width, depth and total count of the sketch.
 func (client *Client) CmsInfo(key string) (map[string]int64, error) {
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
-	return ParseInfoReply(redis.Values(conn.Do("CMS.INFO", key)))
+	return replyDecoder{"CMS.INFO"}.info(conn.Do("CMS.INFO", key))
 }
 
 // Create an empty cuckoo filter with an initial capacity of {capacity} items.
 func (client *Client) CfReserve(key string, capacity int64, bucketSize int64, maxIterations int64, expansion int64) (string, error) {
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
 	args := redis.Args{key}.Add(capacity)
 	if bucketSize > 0 {
@@ -414,32 +495,32 @@ func (client *Client) CfReserve(key string, capacity int64, bucketSize int64, ma
 
 // Adds an item to the cuckoo filter, creating the filter if it does not exist.
 func (client *Client) CfAdd(key string, item string) (bool, error) {
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
 	return redis.Bool(conn.Do("CF.ADD", key, item))
 }
 
 // Adds an item to a cuckoo filter if the item did not exist previously.
 func (client *Client) CfAddNx(key string, item string) (bool, error) {
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
 	return redis.Bool(conn.Do("CF.ADDNX", key, item))
 }
 
 // Adds one or more items to a cuckoo filter, allowing the filter to be created with a custom capacity if it does not yet exist.
+// Large item lists are chunked as configured by client.Chunking, see ChunkOptions: on error, the items of the
+// chunks already applied remain added.
 func (client *Client) CfInsert(key string, cap int64, noCreate bool, items []string) ([]int64, error) {
-	conn := client.Pool.Get()
-	defer conn.Close()
-	args := GetInsertArgs(key, cap, noCreate, items)
-	return redis.Int64s(conn.Do("CF.INSERT", args...))
+	args := GetInsertArgs(key, cap, noCreate, nil)
+	return redis.Int64s(client.doChunked("CF.INSERT", args, redis.Args{}.AddFlat(items)))
 }
 
 // Adds one or more items to a cuckoo filter, allowing the filter to be created with a custom capacity if it does not yet exist.
+// Large item lists are chunked as configured by client.Chunking, see ChunkOptions: on error, the items of the
+// chunks already applied remain added.
 func (client *Client) CfInsertNx(key string, cap int64, noCreate bool, items []string) ([]int64, error) {
-	conn := client.Pool.Get()
-	defer conn.Close()
-	args := GetInsertArgs(key, cap, noCreate, items)
-	return redis.Int64s(conn.Do("CF.INSERTNX", args...))
+	args := GetInsertArgs(key, cap, noCreate, nil)
+	return redis.Int64s(client.doChunked("CF.INSERTNX", args, redis.Args{}.AddFlat(items)))
 }
 
 func GetInsertArgs(key string, cap int64, noCreate bool, items []string) redis.Args {
@@ -456,71 +537,66 @@ func GetInsertArgs(key string, cap int64, noCreate bool, items []string) redis.A
 
 // Check if an item exists in a Cuckoo Filter
 func (client *Client) CfExists(key string, item string) (bool, error) {
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
 	return redis.Bool(conn.Do("CF.EXISTS", key, item))
 }
 
 // Deletes an item once from the filter.
 func (client *Client) CfDel(key string, item string) (bool, error) {
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
 	return redis.Bool(conn.Do("CF.DEL", key, item))
 }
 
 // Returns the number of times an item may be in the filter.
 func (client *Client) CfCount(key string, item string) (int64, error) {
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
 	return redis.Int64(conn.Do("CF.COUNT", key, item))
 }
 
 // Begins an incremental save of the cuckoo filter.
 func (client *Client) CfScanDump(key string, iter int64) (int64, []byte, error) {
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
-	reply, err := redis.Values(conn.Do("CF.SCANDUMP", key, iter))
-	if err != nil || len(reply) != 2 {
-		return 0, nil, err
-	}
-	iter = reply[0].(int64)
-	if reply[1] == nil {
-		return iter, nil, err
-	}
-	return iter, reply[1].([]byte), err
+	return replyDecoder{"CF.SCANDUMP"}.scanDump(conn.Do("CF.SCANDUMP", key, iter))
 }
 
 // Restores a filter previously saved using SCANDUMP
 func (client *Client) CfLoadChunk(key string, iter int64, data []byte) (string, error) {
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
 	return redis.String(conn.Do("CF.LOADCHUNK", key, iter, data))
 }
 
 // Return information about key
 func (client *Client) CfInfo(key string) (map[string]int64, error) {
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
-	return ParseInfoReply(redis.Values(conn.Do("CF.INFO", key)))
+	return replyDecoder{"CF.INFO"}.info(conn.Do("CF.INFO", key))
 }
 
 // TdCreate - Allocate the memory and initialize the t-digest
 func (client *Client) TdCreate(key string, compression int64) (string, error) {
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
+	if caps := client.checkedCapabilities(); caps != nil && caps.legacyTdigest() {
+		return redis.String(conn.Do("TDIGEST.CREATE", key, compression))
+	}
 	return redis.String(conn.Do("TDIGEST.CREATE", key, "COMPRESSION", compression))
 }
 
 // TdReset - Reset the sketch to zero - empty out the sketch and re-initialize it
 func (client *Client) TdReset(key string) (string, error) {
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
 	return redis.String(conn.Do("TDIGEST.RESET", key))
 }
 
 // TdAdd - Adds one or more samples to a sketch
 func (client *Client) TdAdd(key string, samples map[float64]float64) (string, error) {
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
 	args := redis.Args{key}
 	for k, v := range samples {
@@ -530,140 +606,472 @@ func (client *Client) TdAdd(key string, samples map[float64]float64) (string, er
 	return redis.String(reply, err)
 }
 
+// TdAddValues - Adds one or more observations to a sketch. Unlike TdAdd, repeated values are all recorded.
+// Large batches are split into several TDIGEST.ADD commands of at most Chunking.MaxItems values, or
+// tdAddBatchSize when chunking is disabled, pipelined over a single connection; if one of them fails,
+// the observations of the others remain added.
+func (client *Client) TdAddValues(key string, values []float64) (string, error) {
+	if len(values) < 1 {
+		return "", errors.New("a minimum of one value must be added")
+	}
+	batchSize := client.Chunking.MaxItems
+	if batchSize <= 0 {
+		batchSize = tdAddBatchSize
+	}
+	conn := client.getConn()
+	defer conn.Close()
+	// before RedisBloom 2.4 every value is followed by its weight
+	caps := client.checkedCapabilities()
+	legacy := caps != nil && caps.legacyTdigest()
+	cmds := make([]pipelineCmd, 0, len(values)/batchSize+1)
+	for start := 0; start < len(values); start += batchSize {
+		end := start + batchSize
+		if end > len(values) {
+			end = len(values)
+		}
+		args := redis.Args{key}
+		for _, value := range values[start:end] {
+			args = append(args, formatTdFloat(value))
+			if legacy {
+				args = append(args, 1)
+			}
+		}
+		cmds = append(cmds, pipelineCmd{"TDIGEST.ADD", args})
+	}
+	replies, err := doPipeline(conn, cmds)
+	if err != nil {
+		return "", err
+	}
+	for _, reply := range replies {
+		if _, err = redis.String(reply, nil); err != nil {
+			return "", err
+		}
+	}
+	return redis.String(replies[0], nil)
+}
+
 // tdMerge - The internal representation of TdMerge. All underlying functions call this one,
 // returning its results. It allows us to maintain interfaces.
 // see https://redis.io/commands/tdigest.merge/
 //
-// The default values for compression is 100
-func (client *Client) tdMerge(toKey string, compression int64, override bool, numKeys int64, fromKey ...string) (string, error) {
-	if numKeys < 1 {
+// numkeys is derived from fromKey: the numKeys parameter of the exported TdMerge functions is deprecated and ignored.
+// A compression of 0 leaves it to the server, which uses the highest compression of the sources.
+func (client *Client) tdMerge(toKey string, compression int64, override bool, fromKey ...string) (string, error) {
+	if len(fromKey) < 1 {
 		return "", errors.New("a minimum of one key must be merged")
 	}
 
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
-	overidable := ""
+	if caps := client.checkedCapabilities(); caps != nil && caps.legacyTdigest() {
+		return tdMergeLegacy(conn, caps, toKey, compression, override, fromKey)
+	}
+	args := redis.Args{toKey, len(fromKey)}.AddFlat(fromKey)
+	if compression > 0 {
+		args = args.Add("COMPRESSION", compression)
+	}
 	if override {
-		overidable = "1"
+		args = args.Add("OVERRIDE")
+	}
+	return redis.String(conn.Do("TDIGEST.MERGE", args...))
+}
+
+// tdMergeLegacy merges the sources one by one with the TDIGEST.MERGE syntax prior to RedisBloom 2.4,
+// which takes a single source and neither COMPRESSION nor OVERRIDE
+func tdMergeLegacy(conn redis.Conn, caps *Capabilities, toKey string, compression int64, override bool, fromKey []string) (string, error) {
+	if compression > 0 || override {
+		return "", &UnsupportedCommandError{Command: "TDIGEST.MERGE COMPRESSION/OVERRIDE", Version: caps.Version}
+	}
+	cmds := make([]pipelineCmd, len(fromKey))
+	for i, key := range fromKey {
+		cmds[i] = pipelineCmd{"TDIGEST.MERGE", redis.Args{toKey, key}}
+	}
+	replies, err := doPipeline(conn, cmds)
+	if err != nil {
+		return "", err
+	}
+	for _, reply := range replies {
+		if _, err = redis.String(reply, nil); err != nil {
+			return "", err
+		}
 	}
-	return redis.String(conn.Do("TDIGEST.MERGE", toKey,
-		strconv.FormatInt(numKeys, 10),
-		strings.Join(fromKey, " "),
-		"COMPRESSION", compression,
-		overidable))
+	return redis.String(replies[0], nil)
 }
 
 // TdMerge - Merges all of the values from 'from' to 'this' sketch
 func (client *Client) TdMerge(toKey string, numKeys int64, fromKey ...string) (string, error) {
-	return client.tdMerge(toKey, 100, false, numKeys, fromKey...)
+	return client.tdMerge(toKey, 0, false, fromKey...)
 }
 
 // TdMergeWithCompression - Merges all of the values from 'from' to 'this' sketch with specified compression
 func (client *Client) TdMergeWithCompression(toKey string, compression int64, numKeys int64, fromKey ...string) (string, error) {
-	return client.tdMerge(toKey, compression, false, numKeys, fromKey...)
+	return client.tdMerge(toKey, compression, false, fromKey...)
 }
 
-// TdMergeWithOverride - Merges all of the values from 'from' to 'this' sketch overriding the destination key if it exists
+// TdMergeWithOverride - Merges all of the values from 'from' to 'this' sketch, overriding the destination key
+// if it exists and override is true
 func (client *Client) TdMergeWithOverride(toKey string, override bool, numKeys int64, fromKey ...string) (string, error) {
-	return client.tdMerge(toKey, 100, true, numKeys, fromKey...)
+	return client.tdMerge(toKey, 0, override, fromKey...)
 }
 
 // TdMergeWithCompressionAndOverride - Merges all of the values from 'from' to 'this' sketch with specified compression
 // and overriding the destination key if it exists
 func (client *Client) TdMergeWithCompressionAndOverride(toKey string, compression int64, numKeys int64, fromKey ...string) (string, error) {
-	return client.tdMerge(toKey, compression, true, numKeys, fromKey...)
+	return client.tdMerge(toKey, compression, true, fromKey...)
 }
 
 // TdMin - Get minimum value from the sketch. Will return DBL_MAX if the sketch is empty
 func (client *Client) TdMin(key string) (float64, error) {
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
-	return redis.Float64(conn.Do("TDIGEST.MIN", key))
+	return replyDecoder{"TDIGEST.MIN"}.float64(conn.Do("TDIGEST.MIN", key))
 }
 
 // TdMax - Get maximum value from the sketch. Will return DBL_MIN if the sketch is empty
 func (client *Client) TdMax(key string) (float64, error) {
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
-	return redis.Float64(conn.Do("TDIGEST.MAX", key))
+	return replyDecoder{"TDIGEST.MAX"}.float64(conn.Do("TDIGEST.MAX", key))
 }
 
 // TdQuantile - Returns an estimate of the cutoff such that a specified fraction of the data added
 // to this TDigest would be less than or equal to the cutoff
 func (client *Client) TdQuantile(key string, quantile float64) ([]float64, error) {
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
-	return redis.Float64s(conn.Do("TDIGEST.QUANTILE", key, quantile))
+	return replyDecoder{"TDIGEST.QUANTILE"}.float64s(conn.Do("TDIGEST.QUANTILE", key, quantile))
+}
+
+// TdQuantiles - Returns estimates of the cutoffs for several quantiles in a single call.
+// The result holds one value per requested quantile, in the order they were requested.
+func (client *Client) TdQuantiles(key string, quantiles ...float64) ([]float64, error) {
+	conn := client.getConn()
+	defer conn.Close()
+	if caps := client.checkedCapabilities(); caps != nil && caps.legacyTdigest() {
+		return tdPerValue(conn, "TDIGEST.QUANTILE", key, quantiles)
+	}
+	args := redis.Args{key}.AddFlat(formatTdFloats(quantiles))
+	return replyDecoder{"TDIGEST.QUANTILE"}.float64s(conn.Do("TDIGEST.QUANTILE", args...))
+}
+
+// TdQuantilesMulti - Returns estimates of the cutoffs for several quantiles on each of the given keys,
+// pipelining one TDIGEST.QUANTILE per key over a single connection.
+// The result maps every key to one value per requested quantile, in the order they were requested.
+func (client *Client) TdQuantilesMulti(keys []string, quantiles ...float64) (map[string][]float64, error) {
+	conn := client.getConn()
+	defer conn.Close()
+	if caps := client.checkedCapabilities(); caps != nil && caps.legacyTdigest() {
+		result := make(map[string][]float64, len(keys))
+		for _, key := range keys {
+			values, err := tdPerValue(conn, "TDIGEST.QUANTILE", key, quantiles)
+			if err != nil {
+				return nil, fmt.Errorf("TDIGEST.QUANTILE %s: %v", key, err)
+			}
+			result[key] = values
+		}
+		return result, nil
+	}
+	cmds := make([]pipelineCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipelineCmd{"TDIGEST.QUANTILE", redis.Args{key}.AddFlat(formatTdFloats(quantiles))}
+	}
+	replies, err := doPipeline(conn, cmds)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string][]float64, len(keys))
+	for i, key := range keys {
+		result[key], err = replyDecoder{"TDIGEST.QUANTILE"}.float64s(replies[i], nil)
+		if err != nil {
+			return nil, fmt.Errorf("TDIGEST.QUANTILE %s: %v", key, err)
+		}
+	}
+	return result, nil
 }
 
 // TdCdf - Returns the list of fractions of all points added which are <= values
 func (client *Client) TdCdf(key string, values ...float64) ([]float64, error) {
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
+	if caps := client.checkedCapabilities(); caps != nil && caps.legacyTdigest() {
+		return tdPerValue(conn, "TDIGEST.CDF", key, values)
+	}
+	args := redis.Args{key}.AddFlat(formatTdFloats(values))
+	return replyDecoder{"TDIGEST.CDF"}.float64s(conn.Do("TDIGEST.CDF", args...))
+}
 
-	args := make([]string, len(values))
-	for idx, obj := range values {
-		args[idx] = strconv.FormatFloat(obj, 'f', -1, 64)
+// tdPerValue runs cmd once per value, pipelined, with the syntax prior to RedisBloom 2.4 that takes a single value
+func tdPerValue(conn redis.Conn, cmd string, key string, values []float64) ([]float64, error) {
+	cmds := make([]pipelineCmd, len(values))
+	for i, value := range values {
+		cmds[i] = pipelineCmd{cmd, redis.Args{key, formatTdFloat(value)}}
 	}
-	return redis.Float64s(conn.Do("TDIGEST.CDF", key, strings.Join(args, " ")))
+	replies, err := doPipeline(conn, cmds)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]float64, len(values))
+	for i, reply := range replies {
+		if result[i], err = (replyDecoder{cmd}).float64(reply, nil); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// TdRank - Returns, for each value, the rank of the value within the sketch: the number of
+// observations smaller than it, plus half of those equal to it.
+// A rank of TdRankOutOfRange means the value is smaller than the minimum observation, while
+// TdRankEmptySketch is returned for every value when the sketch is empty.
+func (client *Client) TdRank(key string, values ...float64) ([]int64, error) {
+	conn := client.getConn()
+	defer conn.Close()
+	args := redis.Args{key}.AddFlat(formatTdFloats(values))
+	return redis.Int64s(conn.Do("TDIGEST.RANK", args...))
+}
+
+// TdRevRank - Returns, for each value, the reverse rank of the value within the sketch: the number of
+// observations larger than it, plus half of those equal to it.
+// A rank of TdRankOutOfRange means the value is larger than the maximum observation, while
+// TdRankEmptySketch is returned for every value when the sketch is empty.
+func (client *Client) TdRevRank(key string, values ...float64) ([]int64, error) {
+	conn := client.getConn()
+	defer conn.Close()
+	args := redis.Args{key}.AddFlat(formatTdFloats(values))
+	return redis.Int64s(conn.Do("TDIGEST.REVRANK", args...))
+}
+
+// TdByRank - Returns, for each rank, an estimation of the value with that rank (0 is the smallest
+// observation). Ranks past the last observation yield +Inf, and an empty sketch yields NaN.
+func (client *Client) TdByRank(key string, ranks ...int64) ([]float64, error) {
+	conn := client.getConn()
+	defer conn.Close()
+	args := redis.Args{key}.AddFlat(ranks)
+	return replyDecoder{"TDIGEST.BYRANK"}.float64s(conn.Do("TDIGEST.BYRANK", args...))
+}
+
+// TdByRevRank - Returns, for each reverse rank, an estimation of the value with that reverse rank
+// (0 is the largest observation). Ranks past the first observation yield -Inf, and an empty sketch yields NaN.
+func (client *Client) TdByRevRank(key string, ranks ...int64) ([]float64, error) {
+	conn := client.getConn()
+	defer conn.Close()
+	args := redis.Args{key}.AddFlat(ranks)
+	return replyDecoder{"TDIGEST.BYREVRANK"}.float64s(conn.Do("TDIGEST.BYREVRANK", args...))
+}
+
+// TdTrimmedMean - Returns the mean of the observations between the low and high cut quantiles,
+// excluding observations outside them. An empty sketch yields NaN.
+func (client *Client) TdTrimmedMean(key string, lowCutQuantile float64, highCutQuantile float64) (float64, error) {
+	conn := client.getConn()
+	defer conn.Close()
+	return replyDecoder{"TDIGEST.TRIMMED_MEAN"}.float64(conn.Do("TDIGEST.TRIMMED_MEAN", key, formatTdFloat(lowCutQuantile), formatTdFloat(highCutQuantile)))
 }
 
 // TdInfo - Returns compression, capacity, total merged and unmerged nodes, the total
 // compressions made up to date on that key, and merged and unmerged weight.
 func (client *Client) TdInfo(key string) (TDigestInfo, error) {
-	conn := client.Pool.Get()
+	conn := client.getConn()
 	defer conn.Close()
-	return ParseTDigestInfo(redis.Values(conn.Do("TDIGEST.INFO", key)))
+	return ParseTDigestInfo(conn.Do("TDIGEST.INFO", key))
 }
 
-func ParseInfoReply(values []interface{}, err error) (map[string]int64, error) {
+// pipelineCmd is a single command queued by doPipeline
+type pipelineCmd struct {
+	name string
+	args redis.Args
+}
+
+// doPipeline sends all commands over conn in a single round trip and returns their replies in order.
+// A server error for one command is returned in place of its reply rather than failing the pipeline.
+func doPipeline(conn redis.Conn, cmds []pipelineCmd) ([]interface{}, error) {
+	for _, cmd := range cmds {
+		if err := conn.Send(cmd.name, cmd.args...); err != nil {
+			return nil, err
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		return nil, err
+	}
+	replies := make([]interface{}, len(cmds))
+	for i := range cmds {
+		reply, err := conn.Receive()
+		if serverErr, ok := err.(redis.Error); ok {
+			reply, err = serverErr, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		replies[i] = reply
+	}
+	return replies, nil
+}
+
+// formatTdFloat formats a float argument of a TDIGEST command, spelling infinities and NaN
+// the way the server parses them
+func formatTdFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "inf"
+	case math.IsInf(value, -1):
+		return "-inf"
+	case math.IsNaN(value):
+		return "nan"
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func formatTdFloats(values []float64) []string {
+	args := make([]string, len(values))
+	for i, value := range values {
+		args[i] = formatTdFloat(value)
+	}
+	return args
+}
+
+// tdFloat64 is a helper that converts a TDIGEST double reply, a string including "inf", "-inf" and "nan" or a
+// RESP3 double, to a float64
+func tdFloat64(reply interface{}, err error) (float64, error) {
+	if err != nil {
+		return 0, err
+	}
+	switch reply := reply.(type) {
+	case float64:
+		return reply, nil
+	case []byte:
+		return parseTdFloat(string(reply))
+	case string:
+		return parseTdFloat(reply)
+	case int64:
+		return float64(reply), nil
+	case nil:
+		return 0, redis.ErrNil
+	case redis.Error:
+		return 0, reply
+	}
+	return 0, fmt.Errorf("TDIGEST double has type %T", reply)
+}
+
+// tdFloat64s is a helper that converts an array of TDIGEST double replies to a []float64
+func tdFloat64s(reply interface{}, err error) ([]float64, error) {
+	values, err := redis.Values(reply, err)
 	if err != nil {
 		return nil, err
 	}
-	if len(values)%2 != 0 {
-		return nil, errors.New("expects even number of values result")
+	result := make([]float64, len(values))
+	for i, value := range values {
+		result[i], err = tdFloat64(value, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func parseTdFloat(s string) (float64, error) {
+	switch strings.ToLower(s) {
+	case "inf", "+inf":
+		return math.Inf(1), nil
+	case "-inf":
+		return math.Inf(-1), nil
+	case "nan":
+		return math.NaN(), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// ParseInfoReply parses a reply of field/value pairs with integer values, such as CMS.INFO or CF.INFO
+func ParseInfoReply(values []interface{}, err error) (map[string]int64, error) {
+	return replyDecoder{}.info(values, err)
+}
+
+// ParseTopkListWithCount parses a TOPK.LIST WITHCOUNT reply into an ordered slice of TopkItem
+func ParseTopkListWithCount(values []interface{}, err error) ([]TopkItem, error) {
+	d := replyDecoder{"TOPK.LIST"}
+	values, err = d.pairs(values, err)
+	if err != nil {
+		return nil, err
 	}
-	m := make(map[string]int64, len(values)/2)
+	items := make([]TopkItem, 0, len(values)/2)
 	for i := 0; i < len(values); i += 2 {
-		m[values[i].(string)] = values[i+1].(int64)
+		item, err := d.string("item", values[i])
+		if err != nil {
+			return nil, err
+		}
+		count, err := d.int64("count", values[i+1])
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, TopkItem{Item: item, Count: count})
+	}
+	rankTopkItems(items)
+	return items, nil
+}
+
+// rankTopkItems sets the rank of items sorted by decreasing count, tied counts sharing the same rank
+func rankTopkItems(items []TopkItem) {
+	for i := range items {
+		items[i].Rank = int64(i + 1)
+		if i > 0 && items[i-1].Count == items[i].Count {
+			items[i].Rank = items[i-1].Rank
+		}
 	}
-	return m, err
 }
 
+// ParseTopkAddReply parses a TOPK.ADD or TOPK.INCRBY reply, pairing every slot with the given items
+func ParseTopkAddReply(items []string, values []interface{}) (results []TopkAddResult, err error) {
+	d := replyDecoder{}
+	if len(values) != len(items) {
+		return nil, d.errorf("expects %d values, got %d", len(items), len(values))
+	}
+	results = make([]TopkAddResult, len(values))
+	for i, value := range values {
+		results[i].Item = items[i]
+		if value == nil {
+			continue
+		}
+		results[i].ExpelledItem, err = d.string("expelled item", value)
+		if err != nil {
+			return nil, err
+		}
+		results[i].Expelled = true
+	}
+	return results, nil
+}
+
+// ParseTDigestInfo parses a TDIGEST.INFO reply
 func ParseTDigestInfo(result interface{}, err error) (info TDigestInfo, outErr error) {
-	values, outErr := redis.Values(result, err)
+	d := replyDecoder{"TDIGEST.INFO"}
+	values, outErr := d.pairs(result, err)
 	if outErr != nil {
-		return TDigestInfo{}, err
-	}
-	if len(values)%2 != 0 {
-		return TDigestInfo{}, errors.New("ParseInfo expects even number of values result")
+		return TDigestInfo{}, outErr
 	}
-	var key string
 	for i := 0; i < len(values); i += 2 {
-		key, outErr = redis.String(values[i], nil)
+		key, outErr := d.field(values[i])
 		if outErr != nil {
 			return TDigestInfo{}, outErr
 		}
+		var field *int64
 		switch key {
 		case "Compression":
-			info.compression, outErr = redis.Int64(values[i+1], nil)
+			field = &info.compression
 		case "Capacity":
-			info.capacity, outErr = redis.Int64(values[i+1], nil)
+			field = &info.capacity
 		case "Merged nodes":
-			info.mergedNodes, outErr = redis.Int64(values[i+1], nil)
+			field = &info.mergedNodes
 		case "Unmerged nodes":
-			info.unmergedNodes, outErr = redis.Int64(values[i+1], nil)
+			field = &info.unmergedNodes
 		case "Merged weight":
-			info.mergedWeight, outErr = redis.Int64(values[i+1], nil)
+			field = &info.mergedWeight
 		case "Unmerged weight":
-			info.unmergedWeight, outErr = redis.Int64(values[i+1], nil)
+			field = &info.unmergedWeight
 		case "Total compressions":
-			info.totalCompressions, outErr = redis.Int64(values[i+1], nil)
+			field = &info.totalCompressions
+		default:
+			continue
 		}
-		if outErr != nil {
+		if *field, outErr = d.int64(key, values[i+1]); outErr != nil {
 			return TDigestInfo{}, outErr
 		}
 	}
-
 	return info, nil
 }
@@ -1,10 +1,12 @@
 package redis_bloom_go
 
 import (
+	"math"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/RedisBloom/redisbloom-go/internal/redistest"
 	"github.com/gomodule/redigo/redis"
 	"github.com/stretchr/testify/assert"
 )
@@ -251,6 +253,39 @@ func TestClient_TopkQuery(t *testing.T) {
 	assert.Equal(t, map[string]int64{"A": 4, "B": 3, "E": 3}, keysWithCount)
 }
 
+func TestClient_TopkListRanked(t *testing.T) {
+	client.FlushAll()
+	key := "test_topk_list_ranked"
+	ret, err := client.TopkReserve(key, 3, 50, 3, 0.9)
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", ret)
+	client.TopkAdd(key, []string{"A", "B", "C", "D", "E", "A", "A", "B", "C",
+		"G", "D", "B", "D", "A", "E", "E"})
+	items, err := client.TopkListRanked(key)
+	assert.Nil(t, err)
+	assert.Equal(t, []TopkItem{
+		{Item: "A", Count: 4, Rank: 1},
+		{Item: "B", Count: 3, Rank: 2},
+		{Item: "E", Count: 3, Rank: 2},
+	}, items)
+
+	_, err = client.TopkListRanked("notexists")
+	assert.NotNil(t, err)
+}
+
+func TestParseTopkListWithCount(t *testing.T) {
+	items, err := ParseTopkListWithCount([]interface{}{"a", int64(5), []byte("b"), int64(5), "c", int64(2)}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []TopkItem{
+		{Item: "a", Count: 5, Rank: 1},
+		{Item: "b", Count: 5, Rank: 1},
+		{Item: "c", Count: 2, Rank: 3},
+	}, items)
+
+	_, err = ParseTopkListWithCount([]interface{}{"a"}, nil)
+	assert.NotNil(t, err)
+}
+
 func TestClient_TopkInfo(t *testing.T) {
 	client.FlushAll()
 	key := "test_topk_info"
@@ -284,6 +319,45 @@ func TestClient_TopkIncrBy(t *testing.T) {
 	assert.Equal(t, "", rets[2])
 }
 
+func TestClient_TopkAddWithExpelled(t *testing.T) {
+	client.FlushAll()
+	key := "test_topk_add_expelled"
+	ret, err := client.TopkReserve(key, 1, 50, 3, 0.9)
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", ret)
+
+	results, err := client.TopkAddWithExpelled(key, []string{"A"})
+	assert.Nil(t, err)
+	assert.Equal(t, []TopkAddResult{{Item: "A"}}, results)
+
+	events := make(chan TopkExpelledEvent, 10)
+	client.TopkExpelledHandler = TopkExpelledChannel(events)
+	defer func() { client.TopkExpelledHandler = nil }()
+	results, err = client.TopkIncrByWithExpelled(key, []TopkIncrement{{Item: "B", Increment: 10}})
+	assert.Nil(t, err)
+	assert.Equal(t, []TopkAddResult{{Item: "B", Expelled: true, ExpelledItem: "A"}}, results)
+	assert.Equal(t, 1, len(events))
+	event := <-events
+	assert.Equal(t, key, event.Key)
+	assert.Equal(t, "A", event.ExpelledItem)
+
+	_, err = client.TopkAddWithExpelled("notexists", []string{"A"})
+	assert.NotNil(t, err)
+}
+
+func TestParseTopkAddReply(t *testing.T) {
+	results, err := ParseTopkAddReply([]string{"a", "b", "c"}, []interface{}{nil, []byte(""), []byte("x")})
+	assert.Nil(t, err)
+	assert.Equal(t, []TopkAddResult{
+		{Item: "a"},
+		{Item: "b", Expelled: true, ExpelledItem: ""},
+		{Item: "c", Expelled: true, ExpelledItem: "x"},
+	}, results)
+
+	_, err = ParseTopkAddReply([]string{"a"}, []interface{}{nil, nil})
+	assert.NotNil(t, err)
+}
+
 func TestClient_CmsInitByDim(t *testing.T) {
 	client.FlushAll()
 	ret, err := client.CmsInitByDim("test_cms_initbydim", 1000, 5)
@@ -571,6 +645,51 @@ func TestClient_TdReset(t *testing.T) {
 	assert.Equal(t, "OK", ret)
 }
 
+func TestClient_TdAddValues(t *testing.T) {
+	client.FlushAll()
+	key := "test_td"
+	ret, err := client.TdCreate(key, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", ret)
+
+	ret, err = client.TdAddValues(key, []float64{1.0, 1.0, 1.0, 5.0})
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", ret)
+	info, err := client.TdInfo(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), info.UnmergedWeight()+info.MergedWeight())
+	ranks, err := client.TdRank(key, 100.0)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{4}, ranks)
+
+	// force the values to be split over several commands
+	defer func(batchSize int) { tdAddBatchSize = batchSize }(tdAddBatchSize)
+	tdAddBatchSize = 3
+	values := make([]float64, 10)
+	for i := range values {
+		values[i] = float64(i)
+	}
+	ret, err = client.TdAddValues(key, values)
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", ret)
+	info, err = client.TdInfo(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(14), info.UnmergedWeight()+info.MergedWeight())
+
+	_, err = client.TdAddValues("notexists", values)
+	assert.NotNil(t, err)
+}
+
+func TestClient_TdAddValuesEmpty(t *testing.T) {
+	pool := &redistest.Pool{Reply: func(cmd string, args []interface{}) (interface{}, error) {
+		return "OK", nil
+	}}
+	local := &Client{Pool: pool}
+	_, err := local.TdAddValues("td", nil)
+	assert.EqualError(t, err, "a minimum of one value must be added")
+	assert.Equal(t, 0, len(pool.Commands))
+}
+
 func TestClient_TdMerge(t *testing.T) {
 	client.FlushAll()
 	key1 := "toKey"
@@ -648,6 +767,34 @@ func TestClient_TdQuantile(t *testing.T) {
 	assert.Equal(t, 1.0, ans[0])
 }
 
+func TestClient_TdQuantiles(t *testing.T) {
+	client.FlushAll()
+	key1 := "test_td_1"
+	key2 := "test_td_2"
+	for _, key := range []string{key1, key2} {
+		ret, err := client.TdCreate(key, 10)
+		assert.Nil(t, err)
+		assert.Equal(t, "OK", ret)
+	}
+	ret, err := client.TdAdd(key1, map[float64]float64{1.0: 1.0, 2.0: 1.0, 3.0: 1.0})
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", ret)
+	ret, err = client.TdAdd(key2, map[float64]float64{10.0: 10.0, 20.0: 20.0, 30.0: 30.0})
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", ret)
+
+	ans, err := client.TdQuantiles(key1, 1.0, 0.0)
+	assert.Nil(t, err)
+	assert.Equal(t, []float64{3.0, 1.0}, ans)
+
+	multi, err := client.TdQuantilesMulti([]string{key1, key2}, 0.0, 1.0)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]float64{key1: {1.0, 3.0}, key2: {10.0, 30.0}}, multi)
+
+	_, err = client.TdQuantilesMulti([]string{key1, "notexists"}, 0.5)
+	assert.NotNil(t, err)
+}
+
 func TestClient_TdCdf(t *testing.T) {
 	client.FlushAll()
 	key := "test_td"
@@ -668,3 +815,125 @@ func TestClient_TdCdf(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, 0.0, ans[0])
 }
+
+func TestClient_TdRank(t *testing.T) {
+	client.FlushAll()
+	key := "test_td"
+	ret, err := client.TdCreate(key, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", ret)
+
+	ranks, err := client.TdRank(key, 1.0)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{TdRankEmptySketch}, ranks)
+	values, err := client.TdByRank(key, 0)
+	assert.Nil(t, err)
+	assert.True(t, math.IsNaN(values[0]))
+
+	samples := map[float64]float64{1.0: 1.0, 2.0: 2.0, 3.0: 3.0, 4.0: 4.0, 5.0: 5.0}
+	ret, err = client.TdAdd(key, samples)
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", ret)
+
+	ranks, err = client.TdRank(key, 0.0, 100.0)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{TdRankOutOfRange, 10}, ranks)
+
+	ranks, err = client.TdRevRank(key, 100.0, 0.0)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{TdRankOutOfRange, 10}, ranks)
+
+	values, err = client.TdByRank(key, 0, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, 1.0, values[0])
+	assert.True(t, math.IsInf(values[1], 1))
+
+	values, err = client.TdByRevRank(key, 0, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, 5.0, values[0])
+	assert.True(t, math.IsInf(values[1], -1))
+
+	mean, err := client.TdTrimmedMean(key, 0, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 3.0, mean)
+
+	_, err = client.TdRank("notexists", 1.0)
+	assert.NotNil(t, err)
+}
+
+func TestTdFloatEncoding(t *testing.T) {
+	assert.Equal(t, []string{"inf", "-inf", "nan", "0.5", "100"},
+		formatTdFloats([]float64{math.Inf(1), math.Inf(-1), math.NaN(), 0.5, 100}))
+
+	values, err := tdFloat64s([]interface{}{[]byte("inf"), []byte("-inf"), "nan", []byte("2.5"), int64(3)}, nil)
+	assert.Nil(t, err)
+	assert.True(t, math.IsInf(values[0], 1))
+	assert.True(t, math.IsInf(values[1], -1))
+	assert.True(t, math.IsNaN(values[2]))
+	assert.Equal(t, []float64{2.5, 3}, values[3:])
+
+	_, err = tdFloat64s([]interface{}{[]byte("not a number")}, nil)
+	assert.NotNil(t, err)
+}
+
+func TestClient_TdCdfMultipleValues(t *testing.T) {
+	client.FlushAll()
+	key := "test_td"
+	ret, err := client.TdCreate(key, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", ret)
+
+	samples := map[float64]float64{1.0: 1.0, 2.0: 2.0, 3.0: 3.0}
+	ret, err = client.TdAdd(key, samples)
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", ret)
+
+	ans, err := client.TdCdf(key, 0.0, 10.0)
+	assert.Nil(t, err)
+	assert.Equal(t, []float64{0.0, 1.0}, ans)
+}
+
+func TestClient_TdMergeMultipleSources(t *testing.T) {
+	client.FlushAll()
+	toKey := "toKey"
+	fromKeys := []string{"fromKey1", "fromKey2"}
+	ret, err := client.TdCreate(toKey, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", ret)
+	ret, err = client.TdAdd(toKey, map[float64]float64{100.0: 100.0})
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", ret)
+	for i, key := range fromKeys {
+		ret, err = client.TdCreate(key, 10)
+		assert.Nil(t, err)
+		assert.Equal(t, "OK", ret)
+		value := float64(i + 1)
+		ret, err = client.TdAdd(key, map[float64]float64{value: value})
+		assert.Nil(t, err)
+		assert.Equal(t, "OK", ret)
+	}
+
+	ret, err = client.TdMergeWithOverride(toKey, true, 2, fromKeys...)
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", ret)
+	min, err := client.TdMin(toKey)
+	assert.Nil(t, err)
+	assert.Equal(t, 1.0, min)
+	max, err := client.TdMax(toKey)
+	assert.Nil(t, err)
+	assert.Equal(t, 2.0, max)
+
+	ret, err = client.TdMergeWithCompression("newKey", 50, 2, fromKeys...)
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", ret)
+	info, err := client.TdInfo("newKey")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(50), info.Compression())
+
+	// numKeys is ignored
+	ret, err = client.TdMerge(toKey, 1, fromKeys...)
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", ret)
+	_, err = client.TdMerge(toKey, 0)
+	assert.NotNil(t, err)
+}
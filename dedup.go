@@ -0,0 +1,203 @@
+package redis_bloom_go
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// DedupBackend selects the kind of filter backing a Deduplicator
+type DedupBackend int
+
+const (
+	// DedupBloom marks items in a Bloom filter. Items can not be forgotten, except by the window moving on.
+	DedupBloom DedupBackend = iota
+	// DedupCuckoo marks items in a Cuckoo filter with CF.INSERTNX, so they can later be removed with CfDel.
+	// A full Cuckoo filter that can not expand anymore makes SeenOrMark fail with ErrFilterFull.
+	DedupCuckoo
+)
+
+// ErrFilterFull is returned by a Deduplicator when its Cuckoo filter could not mark an item
+var ErrFilterFull = errors.New("cuckoo filter is full")
+
+// DeduplicatorOptions configures a Deduplicator
+type DeduplicatorOptions struct {
+	// Backend is the kind of filter items are marked in
+	Backend DedupBackend
+	// Capacity is the initial capacity of the filter; the server default is used when 0
+	Capacity int64
+	// ErrorRate is the desired false positive rate of a Bloom filter; the server default is used when 0.
+	// The false positive rate of a Cuckoo filter follows from its bucket size, see CfReserve.
+	ErrorRate float64
+	// Interval and Buckets make the deduplication windowed: an item is only reported as seen when it was marked
+	// during the last Interval*Buckets, using one filter per interval like RotatingBloomFilter.
+	// With a zero Interval a single filter remembers items forever.
+	Interval time.Duration
+	Buckets  int
+}
+
+// DedupStats is a struct that represents the activity of a Deduplicator
+type DedupStats struct {
+	// Checked is the number of items checked
+	Checked int64
+	// Seen is the number of items reported as seen before
+	Seen int64
+}
+
+// HitRate returns the fraction of checked items that were reported as seen before
+func (stats DedupStats) HitRate() float64 {
+	if stats.Checked == 0 {
+		return 0
+	}
+	return float64(stats.Seen) / float64(stats.Checked)
+}
+
+// Deduplicator answers "was this item seen before?" and marks it as seen in the same call, for processing events
+// only once. Its contract follows from the filter backing it:
+//
+// - "not seen" is always right: an item that was marked (during the window, when windowed) is never reported as
+// not seen, unless its filter was deleted or, for Cuckoo, the item was removed with CfDel.
+//
+// - "seen" may be a false positive: an item that was never marked is reported as seen with a probability bounded
+// by the error rate of the filter, or up to Buckets times that rate when windowed. Callers must tolerate dropping
+// such an item, or double check it against an exact store.
+type Deduplicator struct {
+	checked int64
+	seen    int64
+	client  *Client
+	key     string
+	opts    DeduplicatorOptions
+	window  *timeWindow
+}
+
+// NewDeduplicator creates a Deduplicator whose filter is stored at key, or under key:<interval number> when windowed
+func NewDeduplicator(client *Client, key string, opts DeduplicatorOptions) (*Deduplicator, error) {
+	d := &Deduplicator{client: client, key: key, opts: opts}
+	if opts.Interval != 0 || opts.Buckets != 0 {
+		window, err := newTimeWindow(key, opts.Interval, opts.Buckets)
+		if err != nil {
+			return nil, err
+		}
+		d.window = &window
+	}
+	return d, nil
+}
+
+// Stats returns the number of items checked and seen so far
+func (d *Deduplicator) Stats() DedupStats {
+	return DedupStats{
+		Checked: atomic.LoadInt64(&d.checked),
+		Seen:    atomic.LoadInt64(&d.seen),
+	}
+}
+
+// SeenOrMark reports whether item was seen before, and marks it as seen
+func (d *Deduplicator) SeenOrMark(item string) (bool, error) {
+	seen, err := d.SeenOrMarkMulti([]string{item})
+	if err != nil {
+		return false, err
+	}
+	return seen[0], nil
+}
+
+// SeenOrMarkMulti reports for each item whether it was seen before, and marks them all as seen.
+// An item repeated within items is reported as seen from its second occurrence on.
+func (d *Deduplicator) SeenOrMarkMulti(items []string) ([]bool, error) {
+	if len(items) == 0 {
+		return []bool{}, nil
+	}
+	var seen []bool
+	var err error
+	if d.window == nil {
+		seen, err = d.mark(items)
+	} else {
+		seen, err = d.markWindowed(items)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var hits int64
+	for _, s := range seen {
+		if s {
+			hits++
+		}
+	}
+	atomic.AddInt64(&d.checked, int64(len(items)))
+	atomic.AddInt64(&d.seen, hits)
+	return seen, nil
+}
+
+// mark adds items to the single filter at key
+func (d *Deduplicator) mark(items []string) ([]bool, error) {
+	var added []int64
+	var err error
+	if d.opts.Backend == DedupCuckoo {
+		added, err = d.client.CfInsertNx(d.key, d.opts.Capacity, false, items)
+	} else if d.opts.Capacity > 0 || d.opts.ErrorRate > 0 {
+		added, err = d.client.BfInsert(d.key, d.opts.Capacity, d.opts.ErrorRate, 0, false, false, items)
+	} else {
+		added, err = d.client.BfAddMulti(d.key, items)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return dedupSeen(items, added, nil)
+}
+
+// markWindowed checks items against the filters of the previous intervals and adds them to the filter of the
+// current interval, all pipelined over a single connection
+func (d *Deduplicator) markWindowed(items []string) ([]bool, error) {
+	buckets := d.window.live()
+	current := d.window.key(buckets[0])
+	existsCmd, insertCmd := "BF.MEXISTS", "BF.INSERT"
+	insertArgs := getBfInsertArgs(current, d.opts.Capacity, d.opts.ErrorRate, 0, false, false)
+	if d.opts.Backend == DedupCuckoo {
+		existsCmd, insertCmd = "CF.MEXISTS", "CF.INSERTNX"
+		insertArgs = GetInsertArgs(current, d.opts.Capacity, false, nil)
+	}
+	cmds := make([]pipelineCmd, 0, len(buckets)+1)
+	for _, bucket := range buckets[1:] {
+		cmds = append(cmds, pipelineCmd{existsCmd, redis.Args{d.window.key(bucket)}.AddFlat(items)})
+	}
+	cmds = append(cmds,
+		pipelineCmd{insertCmd, insertArgs.AddFlat(items)},
+		pipelineCmd{"PEXPIREAT", redis.Args{current, d.window.expireAt(buckets[0])}},
+	)
+	conn := d.client.getConn()
+	defer conn.Close()
+	replies, err := doPipeline(conn, cmds)
+	if err != nil {
+		return nil, err
+	}
+	n := len(buckets) - 1
+	if _, err = redis.Int64(replies[n+1], nil); err != nil {
+		return nil, err
+	}
+	previous, err := mergeExists(len(items), replies[:n])
+	if err != nil {
+		return nil, err
+	}
+	added, err := redis.Int64s(replies[n], nil)
+	if err != nil {
+		return nil, err
+	}
+	return dedupSeen(items, added, previous)
+}
+
+// dedupSeen turns the replies of the insert command, and optionally of the exists commands on previous filters,
+// into the seen flags of items
+func dedupSeen(items []string, added []int64, previous []int64) ([]bool, error) {
+	if len(added) != len(items) {
+		return nil, errors.New("unexpected number of values in result")
+	}
+	seen := make([]bool, len(items))
+	for i, a := range added {
+		if a < 0 {
+			return nil, ErrFilterFull
+		}
+		seen[i] = a == 0 || (previous != nil && previous[i] == 1)
+	}
+	return seen, nil
+}
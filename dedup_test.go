@@ -0,0 +1,180 @@
+package redis_bloom_go
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RedisBloom/redisbloom-go/internal/redistest"
+	"github.com/stretchr/testify/assert"
+)
+
+// filterServer keeps Bloom and Cuckoo filters as plain sets, forgetting a filter once the clock passes
+// the expiration time set with PEXPIREAT
+type filterServer struct {
+	now     *time.Time
+	filters map[string]map[string]bool
+	expires map[string]int64
+}
+
+func newFilterServer(now *time.Time) *filterServer {
+	return &filterServer{now: now, filters: map[string]map[string]bool{}, expires: map[string]int64{}}
+}
+
+func (s *filterServer) filter(key string) map[string]bool {
+	if at, ok := s.expires[key]; ok && s.now.UnixNano()/int64(time.Millisecond) >= at {
+		delete(s.filters, key)
+		delete(s.expires, key)
+	}
+	if s.filters[key] == nil {
+		s.filters[key] = map[string]bool{}
+	}
+	return s.filters[key]
+}
+
+func (s *filterServer) reply(cmd string, args []interface{}) (interface{}, error) {
+	key := args[0].(string)
+	items := args[1:]
+	switch cmd {
+	case "PEXPIREAT":
+		s.expires[key] = args[1].(int64)
+		return int64(1), nil
+	case "BF.INSERT", "CF.INSERTNX":
+		for i, arg := range args {
+			if arg == "ITEMS" {
+				items = args[i+1:]
+			}
+		}
+	}
+	filter := s.filter(key)
+	if cmd == "BF.EXISTS" {
+		return boolInt(filter[args[1].(string)]), nil
+	}
+	reply := make([]interface{}, len(items))
+	for i, item := range items {
+		present := filter[item.(string)]
+		if strings.HasSuffix(cmd, "EXISTS") {
+			reply[i] = boolInt(present)
+			continue
+		}
+		filter[item.(string)] = true
+		reply[i] = boolInt(!present)
+	}
+	return reply, nil
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func TestDeduplicator_SeenOrMarkFake(t *testing.T) {
+	for _, backend := range []DedupBackend{DedupBloom, DedupCuckoo} {
+		now := time.Unix(0, 0)
+		server := newFilterServer(&now)
+		d, err := NewDeduplicator(&Client{Pool: &redistest.Pool{Reply: server.reply}}, "events", DeduplicatorOptions{Backend: backend})
+		assert.Nil(t, err)
+		seen, err := d.SeenOrMark("a")
+		assert.Nil(t, err)
+		assert.False(t, seen)
+		seen, err = d.SeenOrMark("a")
+		assert.Nil(t, err)
+		assert.True(t, seen)
+		// an item repeated within a call is seen from its second occurrence on
+		seenMulti, err := d.SeenOrMarkMulti([]string{"a", "b", "b"})
+		assert.Nil(t, err)
+		assert.Equal(t, []bool{true, false, true}, seenMulti)
+		assert.Equal(t, DedupStats{Checked: 5, Seen: 3}, d.Stats())
+		assert.InDelta(t, 3.0/5, d.Stats().HitRate(), 1e-9)
+	}
+}
+
+func TestDeduplicator_WindowFake(t *testing.T) {
+	for _, backend := range []DedupBackend{DedupBloom, DedupCuckoo} {
+		now := time.Unix(10*60, 0)
+		server := newFilterServer(&now)
+		d, err := NewDeduplicator(&Client{Pool: &redistest.Pool{Reply: server.reply}}, "events", DeduplicatorOptions{
+			Backend:  backend,
+			Capacity: 1000,
+			Interval: time.Minute,
+			Buckets:  2,
+		})
+		assert.Nil(t, err)
+		d.window.now = fakeClock(&now)
+		seen, err := d.SeenOrMarkMulti([]string{"a", "b"})
+		assert.Nil(t, err)
+		assert.Equal(t, []bool{false, false}, seen)
+
+		// items marked during the previous interval are still seen, and marked again
+		now = now.Add(time.Minute)
+		seenOne, err := d.SeenOrMark("a")
+		assert.Nil(t, err)
+		assert.True(t, seenOne)
+
+		// "b" left the window along with the filter of its interval
+		now = now.Add(time.Minute)
+		seen, err = d.SeenOrMarkMulti([]string{"a", "b"})
+		assert.Nil(t, err)
+		assert.Equal(t, []bool{true, false}, seen)
+	}
+
+	_, err := NewDeduplicator(&Client{}, "events", DeduplicatorOptions{Interval: time.Minute})
+	assert.NotNil(t, err)
+}
+
+func TestDeduplicator_FilterFull(t *testing.T) {
+	pool := &redistest.Pool{Reply: func(cmd string, args []interface{}) (interface{}, error) {
+		return []interface{}{int64(1), int64(-1)}, nil
+	}}
+	d, err := NewDeduplicator(&Client{Pool: pool}, "events", DeduplicatorOptions{Backend: DedupCuckoo})
+	assert.Nil(t, err)
+	_, err = d.SeenOrMarkMulti([]string{"a", "b"})
+	assert.Equal(t, ErrFilterFull, err)
+	assert.Equal(t, DedupStats{}, d.Stats())
+}
+
+func TestDeduplicator(t *testing.T) {
+	client.FlushAll()
+	for _, backend := range []DedupBackend{DedupBloom, DedupCuckoo} {
+		d, err := NewDeduplicator(client, "test_dedup", DeduplicatorOptions{Backend: backend, Capacity: 1000})
+		assert.Nil(t, err)
+		seen, err := d.SeenOrMark("a")
+		assert.Nil(t, err)
+		assert.False(t, seen)
+		seen, err = d.SeenOrMark("a")
+		assert.Nil(t, err)
+		assert.True(t, seen)
+		seenMulti, err := d.SeenOrMarkMulti([]string{"a", "b", "b"})
+		assert.Nil(t, err)
+		assert.Equal(t, []bool{true, false, true}, seenMulti)
+		assert.Equal(t, DedupStats{Checked: 5, Seen: 3}, d.Stats())
+		client.FlushAll()
+	}
+
+	d, err := NewDeduplicator(client, "test_dedup_windowed", DeduplicatorOptions{
+		Interval:  time.Hour,
+		Buckets:   2,
+		ErrorRate: 0.001,
+	})
+	assert.Nil(t, err)
+	now := time.Now()
+	d.window.now = fakeClock(&now)
+	seen, err := d.SeenOrMark("a")
+	assert.Nil(t, err)
+	assert.False(t, seen)
+	now = now.Add(time.Hour)
+	seen, err = d.SeenOrMark("a")
+	assert.Nil(t, err)
+	assert.True(t, seen)
+	// "a" was marked again one interval ago, so it is still in the window
+	now = now.Add(time.Hour)
+	seen, err = d.SeenOrMark("a")
+	assert.Nil(t, err)
+	assert.True(t, seen)
+	now = now.Add(2 * time.Hour)
+	seen, err = d.SeenOrMark("a")
+	assert.Nil(t, err)
+	assert.False(t, seen)
+}
@@ -0,0 +1,249 @@
+package redis_bloom_go
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// StructureKind is the kind of a RedisBloom data structure
+type StructureKind string
+
+const (
+	KindBloom    StructureKind = "bloom"
+	KindCuckoo   StructureKind = "cuckoo"
+	KindCountMin StructureKind = "cms"
+	KindTopK     StructureKind = "topk"
+	KindTDigest  StructureKind = "tdigest"
+)
+
+// structureKinds are all the kinds, in the order they are scanned
+var structureKinds = []StructureKind{KindBloom, KindCuckoo, KindCountMin, KindTopK, KindTDigest}
+
+// moduleTypes are the names TYPE and SCAN ... TYPE know the kinds by
+var moduleTypes = map[StructureKind]string{
+	KindBloom:    "MBbloom--",
+	KindCuckoo:   "MBbloomCF",
+	KindCountMin: "CMSk-TYPE",
+	KindTopK:     "TopK-TYPE",
+	KindTDigest:  "TDIS-TYPE",
+}
+
+// infoCommands are the commands describing every kind
+var infoCommands = map[StructureKind]string{
+	KindBloom:    "BF.INFO",
+	KindCuckoo:   "CF.INFO",
+	KindCountMin: "CMS.INFO",
+	KindTopK:     "TOPK.INFO",
+	KindTDigest:  "TDIGEST.INFO",
+}
+
+// ScanKeysOptions configures a keyspace scan
+type ScanKeysOptions struct {
+	// Match is the glob-style pattern of the keys scanned, all keys when empty
+	Match string
+	// Kinds are the kinds of structures scanned, all of them when empty
+	Kinds []StructureKind
+	// Count is the COUNT hint of every SCAN, the server default when 0
+	Count int64
+}
+
+// KeyInfo describes a RedisBloom key found by a keyspace scan
+type KeyInfo struct {
+	Key  string
+	Kind StructureKind
+	// Host is the host of a MultiHostPool the key was found on, empty with other pools, see ScanKeys
+	Host string
+	// Info holds the fields of BF.INFO, CF.INFO or CMS.INFO
+	Info map[string]int64
+	// TopkInfo holds the fields of TOPK.INFO
+	TopkInfo map[string]string
+	// TDigestInfo holds the fields of TDIGEST.INFO
+	TDigestInfo TDigestInfo
+	// MemoryUsage is the number of bytes the key takes, as reported by MEMORY USAGE
+	MemoryUsage int64
+}
+
+// KeyIterator iterates over the RedisBloom keys of the keyspace, fetching them a SCAN page at a time:
+//
+//	it := client.ScanKeys(ScanKeysOptions{Match: "user:*"})
+//	for it.Next() {
+//		key := it.Key()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type KeyIterator struct {
+	client  *Client
+	opts    ScanKeysOptions
+	targets []scanTarget
+	kinds   []StructureKind
+	// target and kind index the host and kind scanned, and cursor is the cursor of their scan, "0" when starting
+	target, kind int
+	cursor       string
+	// page holds the keys fetched and not returned yet
+	page    []KeyInfo
+	current KeyInfo
+	err     error
+}
+
+// scanTarget is a host of the pool whose keyspace is scanned
+type scanTarget struct {
+	host string
+	get  func() redis.Conn
+}
+
+// ScanKeys returns an iterator over the RedisBloom keys, scanned kind by kind with SCAN ... TYPE, which requires
+// Redis 6 or later. Keys are returned once per host they are found on, and may be returned twice, or not at all,
+// when created or deleted during the scan, as SCAN guarantees.
+//
+// The hosts scanned are those of the pool: the topology of a Redis Cluster is not discovered. With a
+// MultiHostPool every host it lists is scanned, so covering a cluster requires listing all its primaries, and
+// with any other pool, such as a SingleHostPool, only the node its connections go to is scanned.
+func (client *Client) ScanKeys(opts ScanKeysOptions) *KeyIterator {
+	kinds := opts.Kinds
+	if len(kinds) == 0 {
+		kinds = structureKinds
+	}
+	return &KeyIterator{client: client, opts: opts, targets: poolHosts(client.Pool), kinds: kinds, cursor: "0"}
+}
+
+// poolHosts returns the hosts listed by pool, the hosts of a MultiHostPool and a single unnamed host otherwise
+func poolHosts(pool ConnPool) []scanTarget {
+	if p, ok := pool.(*MultiHostPool); ok {
+		targets := make([]scanTarget, len(p.hosts))
+		for i, host := range p.hosts {
+			host := host
+			targets[i] = scanTarget{host, func() redis.Conn { return p.getHost(host) }}
+		}
+		return targets
+	}
+	return []scanTarget{{"", pool.Get}}
+}
+
+// Next advances to the next key, returning false once the scan is over or failed
+func (it *KeyIterator) Next() bool {
+	for len(it.page) == 0 {
+		if it.err != nil || it.target >= len(it.targets) {
+			return false
+		}
+		it.err = it.fetch()
+	}
+	it.current = it.page[0]
+	it.page = it.page[1:]
+	return true
+}
+
+// Key returns the key Next advanced to
+func (it *KeyIterator) Key() KeyInfo {
+	return it.current
+}
+
+// Err returns the error the scan failed with, if any
+func (it *KeyIterator) Err() error {
+	return it.err
+}
+
+// fetch scans the next page of keys of the current host and kind, along with their info and memory usage,
+// moving on to the next kind and host once the scan is complete
+func (it *KeyIterator) fetch() error {
+	target, kind := it.targets[it.target], it.kinds[it.kind]
+	moduleType, ok := moduleTypes[kind]
+	if !ok {
+		return fmt.Errorf("unknown structure kind %q", kind)
+	}
+	conn := it.client.hookConn(it.client.context(), target.get())
+	defer conn.Close()
+
+	args := redis.Args{it.cursor}
+	if it.opts.Match != "" {
+		args = args.Add("MATCH", it.opts.Match)
+	}
+	if it.opts.Count > 0 {
+		args = args.Add("COUNT", it.opts.Count)
+	}
+	args = args.Add("TYPE", moduleType)
+	d := replyDecoder{"SCAN"}
+	values, err := d.values(conn.Do("SCAN", args...))
+	if err != nil {
+		return err
+	}
+	if len(values) != 2 {
+		return d.errorf("expects 2 values, got %d", len(values))
+	}
+	cursor, err := d.string("cursor", values[0])
+	if err != nil {
+		return err
+	}
+	keys, err := redis.Strings(values[1], nil)
+	if err != nil {
+		return d.check(err)
+	}
+
+	if cursor == "0" {
+		it.kind++
+		if it.kind == len(it.kinds) {
+			it.kind = 0
+			it.target++
+		}
+	}
+	it.cursor = cursor
+	if len(keys) == 0 {
+		return nil
+	}
+	it.page, err = describeKeys(conn, target.host, kind, keys)
+	return err
+}
+
+// describeKeys pipelines the info and MEMORY USAGE commands of keys, leaving out the keys deleted or replaced
+// since they were scanned
+func describeKeys(conn redis.Conn, host string, kind StructureKind, keys []string) ([]KeyInfo, error) {
+	infoCmd := infoCommands[kind]
+	cmds := make([]pipelineCmd, 0, 2*len(keys))
+	for _, key := range keys {
+		cmds = append(cmds, pipelineCmd{infoCmd, redis.Args{key}}, pipelineCmd{"MEMORY", redis.Args{"USAGE", key}})
+	}
+	replies, err := doPipeline(conn, cmds)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]KeyInfo, 0, len(keys))
+	for i, key := range keys {
+		info := KeyInfo{Key: key, Kind: kind, Host: host}
+		reply := replies[2*i]
+		d := replyDecoder{infoCmd}
+		switch kind {
+		case KindTopK:
+			info.TopkInfo, err = d.topkInfo(reply, nil)
+		case KindTDigest:
+			info.TDigestInfo, err = ParseTDigestInfo(reply, nil)
+		default:
+			info.Info, err = d.info(reply, nil)
+		}
+		if isReplacedKeyError(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		info.MemoryUsage, err = replyDecoder{"MEMORY USAGE"}.int64("memory usage", replies[2*i+1])
+		if err == redis.ErrNil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// isReplacedKeyError reports whether err is the server error of an info command on a key that does not exist,
+// or no longer holds a structure of the kind scanned
+func isReplacedKeyError(err error) bool {
+	serverErr, ok := err.(redis.Error)
+	return ok && (isMissingKeyError(err) || strings.Contains(string(serverErr), "not found") ||
+		strings.HasPrefix(string(serverErr), "WRONGTYPE"))
+}
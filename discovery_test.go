@@ -0,0 +1,136 @@
+package redis_bloom_go
+
+import (
+	"testing"
+
+	"github.com/RedisBloom/redisbloom-go/internal/redistest"
+	"github.com/gomodule/redigo/redis"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// keyspaceServer answers like a server holding the bloom filters bf1, bf2 and gone, the latter deleted before
+// it is described, a count-min sketch, a top-k and a t-digest. Bloom filters are scanned in two pages.
+func keyspaceServer(cmd string, args []interface{}) (interface{}, error) {
+	switch cmd {
+	case "SCAN":
+		keys := map[string][]interface{}{
+			"CMSk-TYPE": {[]byte("cms")},
+			"TopK-TYPE": {[]byte("topk")},
+			"TDIS-TYPE": {[]byte("td")},
+		}[args[len(args)-1].(string)]
+		if args[len(args)-1] == "MBbloom--" {
+			if args[0] == "0" {
+				return []interface{}{[]byte("7"), []interface{}{[]byte("bf1")}}, nil
+			}
+			keys = []interface{}{[]byte("bf2"), []byte("gone")}
+		}
+		return []interface{}{[]byte("0"), keys}, nil
+	case "BF.INFO":
+		if args[0] == "gone" {
+			return nil, redis.Error("ERR not found")
+		}
+		return []interface{}{"Capacity", int64(100), "Expansion rate", nil}, nil
+	case "CMS.INFO":
+		return []interface{}{"width", int64(2000), "depth", int64(5), "count", int64(3)}, nil
+	case "TOPK.INFO":
+		return []interface{}{"k", int64(10), "decay", []byte("0.9")}, nil
+	case "TDIGEST.INFO":
+		return []interface{}{"Compression", int64(100)}, nil
+	case "MEMORY":
+		if args[1] == "gone" {
+			return nil, nil
+		}
+		return int64(len(args[1].(string)) * 100), nil
+	}
+	return nil, redis.Error("ERR unknown command")
+}
+
+func TestClient_ScanKeys(t *testing.T) {
+	pool := &redistest.Pool{Reply: keyspaceServer}
+	client := &Client{Pool: pool}
+	it := client.ScanKeys(ScanKeysOptions{Match: "*", Count: 100})
+	var keys []KeyInfo
+	for it.Next() {
+		keys = append(keys, it.Key())
+	}
+	assert.Nil(t, it.Err())
+	assert.Equal(t, []KeyInfo{
+		{Key: "bf1", Kind: KindBloom, Info: map[string]int64{"Capacity": 100}, MemoryUsage: 300},
+		{Key: "bf2", Kind: KindBloom, Info: map[string]int64{"Capacity": 100}, MemoryUsage: 300},
+		{Key: "cms", Kind: KindCountMin, Info: map[string]int64{"width": 2000, "depth": 5, "count": 3}, MemoryUsage: 300},
+		{Key: "topk", Kind: KindTopK, TopkInfo: map[string]string{"k": "10", "decay": "0.9"}, MemoryUsage: 400},
+		{Key: "td", Kind: KindTDigest, TDigestInfo: TDigestInfo{compression: 100}, MemoryUsage: 200},
+	}, keys)
+	assert.False(t, it.Next())
+
+	assert.Equal(t, []interface{}{"SCAN", "0", "MATCH", "*", "COUNT", int64(100), "TYPE", "MBbloom--"}, pool.Commands[0])
+	assert.Equal(t, []interface{}{"BF.INFO", "bf1"}, pool.Commands[1])
+	assert.Equal(t, []interface{}{"MEMORY", "USAGE", "bf1"}, pool.Commands[2])
+	assert.Equal(t, []interface{}{"SCAN", "7", "MATCH", "*", "COUNT", int64(100), "TYPE", "MBbloom--"}, pool.Commands[3])
+	// the cuckoo filter scan finds nothing
+	assert.Equal(t, []interface{}{"SCAN", "0", "MATCH", "*", "COUNT", int64(100), "TYPE", "MBbloomCF"}, pool.Commands[8])
+}
+
+func TestClient_ScanKeysKinds(t *testing.T) {
+	pool := &redistest.Pool{Reply: keyspaceServer}
+	client := &Client{Pool: pool}
+	it := client.ScanKeys(ScanKeysOptions{Kinds: []StructureKind{KindTDigest}})
+	assert.True(t, it.Next())
+	assert.Equal(t, "td", it.Key().Key)
+	assert.False(t, it.Next())
+	assert.Nil(t, it.Err())
+	assert.Equal(t, []interface{}{"SCAN", "0", "TYPE", "TDIS-TYPE"}, pool.Commands[0])
+
+	it = client.ScanKeys(ScanKeysOptions{Kinds: []StructureKind{"hash"}})
+	assert.False(t, it.Next())
+	assert.EqualError(t, it.Err(), `unknown structure kind "hash"`)
+}
+
+func TestClient_ScanKeysErrors(t *testing.T) {
+	client := &Client{Pool: &redistest.Pool{Reply: func(cmd string, args []interface{}) (interface{}, error) {
+		if cmd == "SCAN" {
+			return []interface{}{[]byte("0")}, nil
+		}
+		return nil, nil
+	}}}
+	it := client.ScanKeys(ScanKeysOptions{})
+	assert.False(t, it.Next())
+	assert.Equal(t, &ReplyError{Command: "SCAN", Reason: "expects 2 values, got 1"}, it.Err())
+
+	client = &Client{Pool: &redistest.Pool{Reply: func(cmd string, args []interface{}) (interface{}, error) {
+		return nil, redis.Error("ERR syntax error")
+	}}}
+	it = client.ScanKeys(ScanKeysOptions{})
+	assert.False(t, it.Next())
+	assert.Equal(t, redis.Error("ERR syntax error"), it.Err())
+}
+
+func TestClient_ScanKeysMultiHost(t *testing.T) {
+	hosts := map[string]*redistest.Pool{
+		"a:6379": {Reply: keyspaceServer},
+		"b:6379": {Reply: func(cmd string, args []interface{}) (interface{}, error) {
+			if cmd == "SCAN" {
+				if args[len(args)-1] == "CMSk-TYPE" {
+					return []interface{}{[]byte("0"), []interface{}{[]byte("cms")}}, nil
+				}
+				return []interface{}{[]byte("0"), []interface{}{}}, nil
+			}
+			return keyspaceServer(cmd, args)
+		}},
+	}
+	pool := NewMultiHostPool([]string{"a:6379", "b:6379"}, nil)
+	pool.dial = func(host string, authPass *string) func() (redis.Conn, error) {
+		return func() (redis.Conn, error) {
+			return hosts[host].Get(), nil
+		}
+	}
+	client := &Client{Pool: pool}
+	it := client.ScanKeys(ScanKeysOptions{Kinds: []StructureKind{KindCountMin}})
+	var found []string
+	for it.Next() {
+		found = append(found, it.Key().Host+"/"+it.Key().Key)
+	}
+	assert.Nil(t, it.Err())
+	assert.Equal(t, []string{"a:6379/cms", "b:6379/cms"}, found)
+}
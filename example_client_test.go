@@ -172,6 +172,33 @@ func ExampleClient_TdQuantile() {
 	// Output: [5]
 }
 
+// exemplifies the TdQuantiles function
+func ExampleClient_TdQuantiles() {
+	host := "localhost:6379"
+	var client = redisbloom.NewClient(host, "nohelp", nil)
+	client.FlushAll()
+
+	key := "example"
+	_, err := client.TdCreate(key, 10)
+	if err != nil {
+		fmt.Println("Error:", err)
+	}
+
+	samples := map[float64]float64{1.0: 1.0, 2.0: 1.0, 3.0: 1.0, 4.0: 1.0, 5.0: 1.0}
+	_, err = client.TdAdd(key, samples)
+	if err != nil {
+		fmt.Println("Error:", err)
+	}
+
+	ans, err := client.TdQuantiles(key, 0.0, 1.0)
+	if err != nil {
+		fmt.Println("Error:", err)
+	}
+
+	fmt.Println(ans)
+	// Output: [1 5]
+}
+
 // exemplifies the TdCdf function
 func ExampleClient_TdCdf() {
 	host := "localhost:6379"
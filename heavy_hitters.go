@@ -0,0 +1,140 @@
+package redis_bloom_go
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// HeavyHitterOptions configures a HeavyHitterTracker
+type HeavyHitterOptions struct {
+	// K is the number of heavy hitters kept in the leaderboard
+	K int64
+	// Width and Depth are the dimensions of the Count-Min Sketch answering point queries, see CmsInitByDim
+	Width int64
+	Depth int64
+	// TopkWidth and TopkDepth are the dimensions of the Top-K, see TopkReserve; Width and Depth are used when 0
+	TopkWidth int64
+	TopkDepth int64
+	// Decay is the decay of the Top-K, see TopkReserve; 0.9 is used when 0
+	Decay float64
+}
+
+// HeavyHitterTracker feeds a stream into a Count-Min Sketch stored at key:cms and a Top-K stored at key:topk.
+// The Top-K only decides which items are the heavy hitters: every count, in Count as in Top, is estimated by
+// the sketch, so both calls agree on the count of an item and counts never underestimate.
+type HeavyHitterTracker struct {
+	client  *Client
+	opts    HeavyHitterOptions
+	cmsKey  string
+	topkKey string
+}
+
+// NewHeavyHitterTracker creates a HeavyHitterTracker storing its structures under key
+func NewHeavyHitterTracker(client *Client, key string, opts HeavyHitterOptions) (*HeavyHitterTracker, error) {
+	if opts.K < 1 || opts.Width < 1 || opts.Depth < 1 {
+		return nil, errors.New("k, width and depth must be positive")
+	}
+	if opts.TopkWidth == 0 {
+		opts.TopkWidth = opts.Width
+	}
+	if opts.TopkDepth == 0 {
+		opts.TopkDepth = opts.Depth
+	}
+	if opts.Decay == 0 {
+		opts.Decay = 0.9
+	}
+	return &HeavyHitterTracker{client: client, opts: opts, cmsKey: key + ":cms", topkKey: key + ":topk"}, nil
+}
+
+// Keys returns the keys of the sketch and of the Top-K
+func (h *HeavyHitterTracker) Keys() []string {
+	return []string{h.cmsKey, h.topkKey}
+}
+
+// Create creates the sketch and the Top-K, pipelined over a single connection
+func (h *HeavyHitterTracker) Create() error {
+	decay := strconv.FormatFloat(h.opts.Decay, 'g', 16, 64)
+	conn := h.client.getConn()
+	defer conn.Close()
+	replies, err := doPipeline(conn, []pipelineCmd{
+		{"CMS.INITBYDIM", redis.Args{h.cmsKey, h.opts.Width, h.opts.Depth}},
+		{"TOPK.RESERVE", redis.Args{h.topkKey, h.opts.K, h.opts.TopkWidth, h.opts.TopkDepth, decay}},
+	})
+	if err != nil {
+		return err
+	}
+	for _, reply := range replies {
+		if _, err := redis.String(reply, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Add counts one occurrence of every item, see IncrBy
+func (h *HeavyHitterTracker) Add(items []string) ([]TopkAddResult, error) {
+	increments := make([]TopkIncrement, len(items))
+	for i, item := range items {
+		increments[i] = TopkIncrement{Item: item, Increment: 1}
+	}
+	return h.IncrBy(increments)
+}
+
+// IncrBy increases the count of items in both structures with one pipelined call, reporting for every increment
+// whether an item was expelled from the leaderboard like TopkIncrByWithExpelled
+func (h *HeavyHitterTracker) IncrBy(increments []TopkIncrement) ([]TopkAddResult, error) {
+	if len(increments) == 0 {
+		return []TopkAddResult{}, nil
+	}
+	cmsArgs := redis.Args{h.cmsKey}
+	items := make([]string, len(increments))
+	for i, incr := range increments {
+		cmsArgs = cmsArgs.Add(incr.Item, incr.Increment)
+		items[i] = incr.Item
+	}
+	topkArgs := append(redis.Args{h.topkKey}, cmsArgs[1:]...)
+	conn := h.client.getConn()
+	defer conn.Close()
+	replies, err := doPipeline(conn, []pipelineCmd{{"CMS.INCRBY", cmsArgs}, {"TOPK.INCRBY", topkArgs}})
+	if err != nil {
+		return nil, err
+	}
+	if _, err = redis.Int64s(replies[0], nil); err != nil {
+		return nil, err
+	}
+	values, err := redis.Values(replies[1], nil)
+	if err != nil {
+		return nil, err
+	}
+	return h.client.topkExpelled(h.topkKey, items, values)
+}
+
+// Count returns the estimated count of items
+func (h *HeavyHitterTracker) Count(items []string) ([]int64, error) {
+	return h.client.CmsQuery(h.cmsKey, items)
+}
+
+// Top returns the heavy hitters with their estimated counts, most frequent first
+func (h *HeavyHitterTracker) Top() ([]TopkItem, error) {
+	items, err := h.client.TopkList(h.topkKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return []TopkItem{}, nil
+	}
+	counts, err := h.Count(items)
+	if err != nil {
+		return nil, err
+	}
+	if len(counts) != len(items) {
+		return nil, replyDecoder{"CMS.QUERY"}.errorf("expects %d values, got %d", len(items), len(counts))
+	}
+	byItem := make(map[string]int64, len(items))
+	for i, item := range items {
+		byItem[item] = counts[i]
+	}
+	return topkFromCounts(byItem, h.opts.K), nil
+}
@@ -0,0 +1,109 @@
+package redis_bloom_go
+
+import (
+	"testing"
+
+	"github.com/RedisBloom/redisbloom-go/internal/redistest"
+	"github.com/stretchr/testify/assert"
+)
+
+// heavyHitterServer counts exactly in the sketch, while its Top-K lists "a" and "b" and expels "c" on every
+// increment of "b"
+func heavyHitterServer(counts map[string]int64) func(cmd string, args []interface{}) (interface{}, error) {
+	return func(cmd string, args []interface{}) (interface{}, error) {
+		var reply []interface{}
+		switch cmd {
+		case "CMS.INCRBY":
+			for i := 1; i < len(args); i += 2 {
+				counts[args[i].(string)] += args[i+1].(int64)
+				reply = append(reply, counts[args[i].(string)])
+			}
+		case "CMS.QUERY":
+			for _, item := range args[1:] {
+				reply = append(reply, counts[item.(string)])
+			}
+		case "TOPK.INCRBY":
+			for i := 1; i < len(args); i += 2 {
+				if args[i] == "b" {
+					reply = append(reply, []byte("c"))
+				} else {
+					reply = append(reply, nil)
+				}
+			}
+		case "TOPK.LIST":
+			reply = []interface{}{[]byte("a"), []byte("b")}
+		default:
+			return "OK", nil
+		}
+		return reply, nil
+	}
+}
+
+func TestHeavyHitterTracker_IncrByReportsExpulsions(t *testing.T) {
+	var expelled []string
+	local := &Client{
+		Pool: &redistest.Pool{Reply: heavyHitterServer(map[string]int64{})},
+		TopkExpelledHandler: func(key string, result TopkAddResult) {
+			expelled = append(expelled, key+" "+result.ExpelledItem)
+		},
+	}
+	h, err := NewHeavyHitterTracker(local, "hh", HeavyHitterOptions{K: 2, Width: 100, Depth: 5})
+	assert.Nil(t, err)
+	results, err := h.IncrBy([]TopkIncrement{{"a", 1}, {"b", 2}})
+	assert.Nil(t, err)
+	assert.Equal(t, []TopkAddResult{{Item: "a"}, {Item: "b", Expelled: true, ExpelledItem: "c"}}, results)
+	assert.Equal(t, []string{"hh:topk c"}, expelled)
+
+	results, err = h.Add(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []TopkAddResult{}, results)
+}
+
+func TestHeavyHitterTracker_TopCountsFromSketch(t *testing.T) {
+	h, err := NewHeavyHitterTracker(&Client{Pool: &redistest.Pool{Reply: heavyHitterServer(map[string]int64{})}}, "hh", HeavyHitterOptions{K: 2, Width: 100, Depth: 5})
+	assert.Nil(t, err)
+	_, err = h.IncrBy([]TopkIncrement{{"a", 3}, {"b", 7}})
+	assert.Nil(t, err)
+	_, err = h.Add([]string{"a"})
+	assert.Nil(t, err)
+
+	// the leaderboard is ordered by the counts of the sketch, which Count agrees with
+	top, err := h.Top()
+	assert.Nil(t, err)
+	assert.Equal(t, []TopkItem{{Item: "b", Count: 7, Rank: 1}, {Item: "a", Count: 4, Rank: 2}}, top)
+	counts, err := h.Count([]string{"a", "b"})
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{4, 7}, counts)
+}
+
+func TestHeavyHitterTracker_Options(t *testing.T) {
+	pool := &redistest.Pool{Reply: heavyHitterServer(map[string]int64{})}
+	h, err := NewHeavyHitterTracker(&Client{Pool: pool}, "hh", HeavyHitterOptions{K: 2, Width: 100, Depth: 5})
+	assert.Nil(t, err)
+	assert.Nil(t, h.Create())
+	// the Top-K takes the dimensions of the sketch and the default decay
+	assert.Equal(t, [][]interface{}{{"TOPK.RESERVE", "hh:topk", int64(2), int64(100), int64(5), "0.9"}}, pool.Sent("TOPK.RESERVE"))
+
+	_, err = NewHeavyHitterTracker(&Client{}, "hh", HeavyHitterOptions{Width: 100, Depth: 5})
+	assert.NotNil(t, err)
+}
+
+func TestHeavyHitterTracker(t *testing.T) {
+	client.FlushAll()
+	h, err := NewHeavyHitterTracker(client, "test_heavy_hitters", HeavyHitterOptions{K: 2, Width: 1000, Depth: 5})
+	assert.Nil(t, err)
+	assert.Nil(t, h.Create())
+	assert.NotNil(t, h.Create())
+
+	_, err = h.Add([]string{"a", "b", "b", "c", "c", "c"})
+	assert.Nil(t, err)
+	_, err = h.IncrBy([]TopkIncrement{{"a", 10}})
+	assert.Nil(t, err)
+
+	counts, err := h.Count([]string{"a", "b", "c", "d"})
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{11, 2, 3, 0}, counts)
+	top, err := h.Top()
+	assert.Nil(t, err)
+	assert.Equal(t, []TopkItem{{Item: "a", Count: 11, Rank: 1}, {Item: "c", Count: 3, Rank: 2}}, top)
+}
@@ -0,0 +1,460 @@
+package redis_bloom_go
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Command is a struct that represents one command sent to the server, as seen by a Hook
+type Command struct {
+	// Name is the name of the command, such as BF.ADD
+	Name string
+	// Args are the arguments of the command. A BeforeProcess hook may change them before the command is sent.
+	Args []interface{}
+	// Pipelined reports whether the command is part of a pipeline
+	Pipelined bool
+	// Start is the time the command was sent, and Duration the time it took to get its reply
+	Start    time.Time
+	Duration time.Duration
+	// Reply and Err are the outcome of the command, set before AfterProcess is called
+	Reply interface{}
+	Err   error
+}
+
+// Key returns the key cmd operates on, if any
+func (cmd *Command) Key() (string, bool) {
+	return commandKey(cmd.Name, cmd.Args)
+}
+
+// ItemCount returns the number of items cmd carries, for the multi-item commands
+func (cmd *Command) ItemCount() (int, bool) {
+	return commandItemCount(cmd.Name, cmd.Args)
+}
+
+// Family returns the RedisBloom module of cmd: BF, CF, CMS, TOPK or TDIGEST, and REDIS for any other command
+func (cmd *Command) Family() string {
+	return commandFamily(cmd.Name)
+}
+
+// Hook is a middleware around the commands of a Client, set in Client.Hooks.
+//
+// BeforeProcess is called before a command is sent and returns the context passed on to the next hooks and to
+// its own AfterProcess. Returning an error fails the command without sending it. AfterProcess is called once the
+// reply is in, or once the command failed, and returns the error reported for the command: cmd.Err to leave it
+// unchanged, another error to replace it, or nil to clear it. BeforeProcess hooks run in order, AfterProcess hooks
+// in reverse order, and AfterProcess is only called for the hooks whose BeforeProcess succeeded.
+//
+// Commands pipelined on one connection, including MULTI/EXEC transactions, are handed to the hooks when flushed:
+// BeforeProcessPipeline is called first with the commands of the flush, and its context is the one the
+// BeforeProcess of every command of the pipeline starts from. AfterProcessPipeline is called once the last reply
+// of the flush was received; a non nil error is reported by the receive of that last reply.
+type Hook interface {
+	BeforeProcess(ctx context.Context, cmd *Command) (context.Context, error)
+	AfterProcess(ctx context.Context, cmd *Command) error
+	BeforeProcessPipeline(ctx context.Context, cmds []*Command) (context.Context, error)
+	AfterProcessPipeline(ctx context.Context, cmds []*Command) error
+}
+
+// WithContext returns a shallow copy of client whose commands use ctx. The hooks see ctx. Waiting for a
+// connection of a pool with a GetContext method, such as the pools of this package, and the commands on
+// connections implementing redis.ConnWithContext are canceled along with it.
+func (client *Client) WithContext(ctx context.Context) *Client {
+	// the copy shares the capabilities probed by client
+	client.capabilitiesProbe()
+	c := *client
+	c.ctx = ctx
+	return &c
+}
+
+func (client *Client) context() context.Context {
+	if client.ctx == nil {
+		return context.Background()
+	}
+	return client.ctx
+}
+
+// getConn returns a connection of the pool for the commands of client
+func (client *Client) getConn() redis.Conn {
+	return client.getConnContext(client.context())
+}
+
+// contextPool is implemented by the pools that can give up waiting for a connection along with a context,
+// such as redis.Pool
+type contextPool interface {
+	GetContext(ctx context.Context) (redis.Conn, error)
+}
+
+// getConnContext returns a connection of the pool running client.Hooks, and the capability check when enabled,
+// around its commands, with ctx as the context of the first hook
+func (client *Client) getConnContext(ctx context.Context) redis.Conn {
+	pool, ok := client.Pool.(contextPool)
+	if !ok || ctx.Done() == nil {
+		return client.hookConn(ctx, client.Pool.Get())
+	}
+	conn, err := pool.GetContext(ctx)
+	if err != nil {
+		conn = errorConn{err}
+	}
+	return client.hookConn(ctx, conn)
+}
+
+// errorConn is the connection returned when none could be obtained, failing every command with err
+type errorConn struct {
+	err error
+}
+
+func (c errorConn) Do(string, ...interface{}) (interface{}, error) { return nil, c.err }
+func (c errorConn) Send(string, ...interface{}) error              { return c.err }
+func (c errorConn) Err() error                                     { return c.err }
+func (c errorConn) Close() error                                   { return nil }
+func (c errorConn) Flush() error                                   { return c.err }
+func (c errorConn) Receive() (interface{}, error)                  { return nil, c.err }
+
+// hookConn wraps conn, a connection of client.Pool, to run the hooks of client around its commands
+func (client *Client) hookConn(ctx context.Context, conn redis.Conn) redis.Conn {
+	hooks := client.Hooks
+	if client.CheckCapabilities {
+		client.probeConn(conn)
+		hooks = append(hooks[:len(hooks):len(hooks)], capabilityCheck{client})
+	}
+	if len(hooks) == 0 {
+		if ctx.Done() == nil {
+			return conn
+		}
+		return contextConn{Conn: conn, ctx: ctx}
+	}
+	return &hookedConn{Conn: conn, hooks: hooks, ctx: ctx}
+}
+
+// contextConn is a redis.Conn whose commands are canceled along with ctx, when the connection supports it
+type contextConn struct {
+	redis.Conn
+	ctx context.Context
+}
+
+func (c contextConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	return doContext(c.Conn, c.ctx, cmd, args...)
+}
+
+func (c contextConn) Receive() (interface{}, error) {
+	return receiveContext(c.Conn, c.ctx)
+}
+
+// hookedCmd is a command going through the hooks
+type hookedCmd struct {
+	cmd *Command
+	// ctxs are the contexts returned by the BeforeProcess of every hook that ran
+	ctxs []context.Context
+	// aborted is set when a hook failed the command before it was sent
+	aborted bool
+}
+
+// hookedPipeline is the batch of commands of one flush
+type hookedPipeline struct {
+	ctxs []context.Context
+	cmds []*hookedCmd
+	// next is the index of the command whose reply is received next
+	next int
+}
+
+// hookedConn is a redis.Conn running hooks around its commands
+type hookedConn struct {
+	redis.Conn
+	hooks []Hook
+	ctx   context.Context
+	// buffered are the commands sent and not flushed yet
+	buffered []*Command
+	// pipelines are the flushed pipelines whose replies are not all received yet, oldest first
+	pipelines []*hookedPipeline
+}
+
+// before runs the BeforeProcess hooks of cmd, starting from ctx
+func (c *hookedConn) before(ctx context.Context, cmd *Command) *hookedCmd {
+	hc := &hookedCmd{cmd: cmd, ctxs: make([]context.Context, 0, len(c.hooks))}
+	for _, hook := range c.hooks {
+		next, err := hook.BeforeProcess(ctx, cmd)
+		if err != nil {
+			cmd.Err = err
+			hc.aborted = true
+			return hc
+		}
+		ctx = next
+		hc.ctxs = append(hc.ctxs, ctx)
+	}
+	return hc
+}
+
+// after runs the AfterProcess hooks of the hooks whose BeforeProcess ran
+func (c *hookedConn) after(hc *hookedCmd) {
+	for i := len(hc.ctxs) - 1; i >= 0; i-- {
+		hc.cmd.Err = c.hooks[i].AfterProcess(hc.ctxs[i], hc.cmd)
+	}
+}
+
+// ctx returns the context the command is run with
+func (hc *hookedCmd) ctx(parent context.Context) context.Context {
+	if len(hc.ctxs) == 0 {
+		return parent
+	}
+	return hc.ctxs[len(hc.ctxs)-1]
+}
+
+func (c *hookedConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if cmd == "" {
+		return c.drain()
+	}
+	if len(c.buffered) > 0 || len(c.pipelines) > 0 {
+		// the command completes the pipeline, as redigo reads the pending replies first
+		if err := c.Send(cmd, args...); err != nil {
+			return nil, err
+		}
+		replies, err := c.drain()
+		if err != nil {
+			return nil, err
+		}
+		values, _ := replies.([]interface{})
+		if len(values) == 0 {
+			return nil, nil
+		}
+		for _, reply := range values[:len(values)-1] {
+			if serverErr, ok := reply.(redis.Error); ok {
+				return values[len(values)-1], serverErr
+			}
+		}
+		last := values[len(values)-1]
+		if serverErr, ok := last.(redis.Error); ok {
+			return nil, serverErr
+		}
+		return last, nil
+	}
+
+	hc := c.before(c.ctx, &Command{Name: cmd, Args: args})
+	if !hc.aborted {
+		hc.cmd.Start = time.Now()
+		hc.cmd.Reply, hc.cmd.Err = doContext(c.Conn, hc.ctx(c.ctx), hc.cmd.Name, hc.cmd.Args...)
+		hc.cmd.Duration = time.Since(hc.cmd.Start)
+	}
+	c.after(hc)
+	return hc.cmd.Reply, hc.cmd.Err
+}
+
+// doContext runs cmd on conn, canceled along with ctx when conn supports it
+func doContext(conn redis.Conn, ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	if ctx.Done() != nil {
+		if connWithContext, ok := conn.(redis.ConnWithContext); ok {
+			return connWithContext.DoContext(ctx, cmd, args...)
+		}
+	}
+	return conn.Do(cmd, args...)
+}
+
+// receiveContext receives a reply on conn, canceled along with ctx when conn supports it
+func receiveContext(conn redis.Conn, ctx context.Context) (interface{}, error) {
+	if ctx.Done() != nil {
+		if connWithContext, ok := conn.(redis.ConnWithContext); ok {
+			return connWithContext.ReceiveContext(ctx)
+		}
+	}
+	return conn.Receive()
+}
+
+// drain flushes the buffered commands and receives all the pending replies, like Do("")
+func (c *hookedConn) drain() (interface{}, error) {
+	if len(c.buffered) == 0 && len(c.pipelines) == 0 {
+		return doContext(c.Conn, c.ctx, "")
+	}
+	if err := c.Flush(); err != nil {
+		return nil, err
+	}
+	var replies []interface{}
+	for len(c.pipelines) > 0 {
+		reply, err := c.Receive()
+		if serverErr, ok := err.(redis.Error); ok {
+			reply, err = serverErr, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		replies = append(replies, reply)
+	}
+	return replies, nil
+}
+
+func (c *hookedConn) Send(cmd string, args ...interface{}) error {
+	c.buffered = append(c.buffered, &Command{Name: cmd, Args: args, Pipelined: true})
+	return nil
+}
+
+func (c *hookedConn) Flush() error {
+	if len(c.buffered) == 0 {
+		return c.Conn.Flush()
+	}
+	cmds := c.buffered
+	c.buffered = nil
+	p := &hookedPipeline{ctxs: make([]context.Context, 0, len(c.hooks))}
+	ctx := c.ctx
+	for _, hook := range c.hooks {
+		next, err := hook.BeforeProcessPipeline(ctx, cmds)
+		if err != nil {
+			for _, cmd := range cmds {
+				cmd.Err = err
+			}
+			c.afterPipeline(p, cmds)
+			return err
+		}
+		ctx = next
+		p.ctxs = append(p.ctxs, ctx)
+	}
+
+	var sendErr error
+	for _, cmd := range cmds {
+		hc := c.before(ctx, cmd)
+		if !hc.aborted && sendErr == nil {
+			cmd.Start = time.Now()
+			sendErr = c.Conn.Send(cmd.Name, cmd.Args...)
+		}
+		if sendErr != nil && !hc.aborted {
+			cmd.Err = sendErr
+			hc.aborted = true
+		}
+		p.cmds = append(p.cmds, hc)
+	}
+	c.pipelines = append(c.pipelines, p)
+	err := sendErr
+	if err == nil {
+		err = c.Conn.Flush()
+	}
+	if err != nil {
+		// the connection is unusable, fail all the commands not received yet
+		for _, p := range c.pipelines {
+			for _, hc := range p.cmds[p.next:] {
+				if hc.cmd.Err == nil {
+					hc.cmd.Err = err
+				}
+				c.after(hc)
+			}
+			c.afterPipeline(p, commandsOf(p.cmds))
+		}
+		c.pipelines = nil
+		return err
+	}
+	return nil
+}
+
+func (c *hookedConn) Receive() (interface{}, error) {
+	if len(c.pipelines) == 0 {
+		return receiveContext(c.Conn, c.ctx)
+	}
+	p := c.pipelines[0]
+	hc := p.cmds[p.next]
+	p.next++
+	if !hc.aborted {
+		hc.cmd.Reply, hc.cmd.Err = receiveContext(c.Conn, hc.ctx(c.ctx))
+		hc.cmd.Duration = time.Since(hc.cmd.Start)
+	}
+	c.after(hc)
+	reply, err := hc.cmd.Reply, hc.cmd.Err
+	if p.next == len(p.cmds) {
+		c.pipelines = c.pipelines[1:]
+		if pipelineErr := c.afterPipeline(p, commandsOf(p.cmds)); pipelineErr != nil && err == nil {
+			err = pipelineErr
+		}
+	}
+	return reply, err
+}
+
+// afterPipeline runs the AfterProcessPipeline hooks of the hooks whose BeforeProcessPipeline ran
+func (c *hookedConn) afterPipeline(p *hookedPipeline, cmds []*Command) error {
+	var err error
+	for i := len(p.ctxs) - 1; i >= 0; i-- {
+		if hookErr := c.hooks[i].AfterProcessPipeline(p.ctxs[i], cmds); hookErr != nil && err == nil {
+			err = hookErr
+		}
+	}
+	return err
+}
+
+func (c *hookedConn) Close() error {
+	for _, p := range c.pipelines {
+		for _, hc := range p.cmds[p.next:] {
+			c.after(hc)
+		}
+		c.afterPipeline(p, commandsOf(p.cmds))
+	}
+	c.pipelines = nil
+	return c.Conn.Close()
+}
+
+func commandsOf(hcs []*hookedCmd) []*Command {
+	cmds := make([]*Command, len(hcs))
+	for i, hc := range hcs {
+		cmds[i] = hc.cmd
+	}
+	return cmds
+}
+
+// commandKey returns the key cmd operates on, if any
+func commandKey(cmd string, args []interface{}) (string, bool) {
+	switch strings.ToUpper(cmd) {
+	case "MULTI", "EXEC", "DISCARD", "PING", "MODULE", "COMMAND", "INFO", "SCAN", "FLUSHALL", "HELLO":
+		return "", false
+	case "MEMORY":
+		if len(args) < 2 {
+			return "", false
+		}
+		return formatArg(args[1]), true
+	case "EVAL", "EVALSHA":
+		if len(args) < 3 || fmt.Sprint(args[1]) == "0" {
+			return "", false
+		}
+		return formatArg(args[2]), true
+	}
+	if len(args) == 0 {
+		return "", false
+	}
+	return formatArg(args[0]), true
+}
+
+// commandItemCount returns the number of items a multi-item command carries
+func commandItemCount(cmd string, args []interface{}) (int, bool) {
+	if len(args) == 0 {
+		return 0, false
+	}
+	switch strings.ToUpper(cmd) {
+	case "BF.ADD", "BF.EXISTS", "BF.MADD", "BF.MEXISTS", "CF.ADD", "CF.ADDNX", "CF.EXISTS", "CF.MEXISTS",
+		"CF.DEL", "CF.COUNT", "CMS.QUERY", "TOPK.ADD", "TOPK.QUERY", "TOPK.COUNT", "TDIGEST.ADD":
+		return len(args) - 1, true
+	case "CMS.INCRBY", "TOPK.INCRBY":
+		return (len(args) - 1) / 2, true
+	case "BF.INSERT", "CF.INSERT", "CF.INSERTNX":
+		// args[0] is the key, which may well be named ITEMS
+		for i := 1; i < len(args); i++ {
+			if s, ok := args[i].(string); ok && strings.EqualFold(s, "ITEMS") {
+				return len(args) - i - 1, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// commandFamily returns the RedisBloom module family of cmd
+func commandFamily(cmd string) string {
+	if i := strings.IndexByte(cmd, '.'); i > 0 {
+		switch family := strings.ToUpper(cmd[:i]); family {
+		case "BF", "CF", "CMS", "TOPK", "TDIGEST":
+			return family
+		}
+	}
+	return "REDIS"
+}
+
+func formatArg(arg interface{}) string {
+	if b, ok := arg.([]byte); ok {
+		return string(b)
+	}
+	return fmt.Sprint(arg)
+}
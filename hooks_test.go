@@ -0,0 +1,255 @@
+package redis_bloom_go
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/RedisBloom/redisbloom-go/internal/redistest"
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+type hookCtxKey string
+
+// recordingHook records the calls it gets in events, and fails or changes commands on demand
+type recordingHook struct {
+	name   string
+	events *[]string
+	before func(cmd *Command) error
+	after  func(cmd *Command) error
+}
+
+func (h *recordingHook) BeforeProcess(ctx context.Context, cmd *Command) (context.Context, error) {
+	*h.events = append(*h.events, fmt.Sprintf("%s before %s %v", h.name, cmd.Name, ctx.Value(hookCtxKey("pipeline"))))
+	if h.before != nil {
+		if err := h.before(cmd); err != nil {
+			return nil, err
+		}
+	}
+	return context.WithValue(ctx, hookCtxKey(h.name), cmd.Name), nil
+}
+
+func (h *recordingHook) AfterProcess(ctx context.Context, cmd *Command) error {
+	*h.events = append(*h.events, fmt.Sprintf("%s after %s %v %v", h.name, cmd.Name, ctx.Value(hookCtxKey(h.name)), cmd.Err))
+	if h.after != nil {
+		return h.after(cmd)
+	}
+	return cmd.Err
+}
+
+func (h *recordingHook) BeforeProcessPipeline(ctx context.Context, cmds []*Command) (context.Context, error) {
+	*h.events = append(*h.events, fmt.Sprintf("%s before pipeline %d", h.name, len(cmds)))
+	return context.WithValue(ctx, hookCtxKey("pipeline"), h.name), nil
+}
+
+func (h *recordingHook) AfterProcessPipeline(ctx context.Context, cmds []*Command) error {
+	*h.events = append(*h.events, fmt.Sprintf("%s after pipeline %d", h.name, len(cmds)))
+	return nil
+}
+
+func TestHooks_Command(t *testing.T) {
+	var events []string
+	pool := &redistest.Pool{Reply: func(cmd string, args []interface{}) (interface{}, error) {
+		return int64(1), nil
+	}}
+	client := &Client{Pool: pool, Hooks: []Hook{
+		&recordingHook{name: "a", events: &events},
+		&recordingHook{name: "b", events: &events, before: func(cmd *Command) error {
+			// redact the item
+			cmd.Args = []interface{}{cmd.Args[0], "?"}
+			return nil
+		}},
+	}}
+	exists, err := client.Add("filter", "secret")
+	assert.Nil(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, [][]interface{}{{"BF.ADD", "filter", "?"}}, pool.Commands)
+	assert.Equal(t, []string{
+		"a before BF.ADD <nil>",
+		"b before BF.ADD <nil>",
+		"b after BF.ADD BF.ADD <nil>",
+		"a after BF.ADD BF.ADD <nil>",
+	}, events)
+}
+
+func TestHooks_Errors(t *testing.T) {
+	var events []string
+	injected := errors.New("injected")
+	pool := &redistest.Pool{Reply: func(cmd string, args []interface{}) (interface{}, error) {
+		return nil, redis.Error("ERR not found")
+	}}
+	fail := true
+	client := &Client{Pool: pool, Hooks: []Hook{
+		&recordingHook{name: "a", events: &events, after: func(cmd *Command) error {
+			if cmd.Err == injected {
+				return errors.New("wrapped")
+			}
+			return nil
+		}},
+		&recordingHook{name: "b", events: &events, before: func(cmd *Command) error {
+			if fail {
+				return injected
+			}
+			return nil
+		}},
+	}}
+
+	// b fails the command before it is sent, so only a gets AfterProcess
+	_, err := client.Info("filter")
+	assert.Equal(t, "wrapped", err.Error())
+	assert.Equal(t, 0, len(pool.Commands))
+	assert.Equal(t, []string{
+		"a before BF.INFO <nil>",
+		"b before BF.INFO <nil>",
+		"a after BF.INFO BF.INFO injected",
+	}, events)
+
+	// a clears the server error
+	fail = false
+	_, err = client.getConn().Do("BF.INFO", "filter")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pool.Commands))
+}
+
+func TestHooks_Pipeline(t *testing.T) {
+	var events []string
+	pool := &redistest.Pool{Reply: func(cmd string, args []interface{}) (interface{}, error) {
+		if cmd == "CF.DEL" {
+			return redis.Error("ERR not found"), nil
+		}
+		return "OK", nil
+	}}
+	client := &Client{Pool: pool, Hooks: []Hook{&recordingHook{name: "a", events: &events}}}
+	replies, err := doPipeline(client.getConn(), []pipelineCmd{
+		{"BF.ADD", redis.Args{"k", "a"}},
+		{"CF.DEL", redis.Args{"k", "a"}},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"OK", redis.Error("ERR not found")}, replies)
+	assert.Equal(t, []string{
+		"a before pipeline 2",
+		"a before BF.ADD a",
+		"a before CF.DEL a",
+		"a after BF.ADD BF.ADD <nil>",
+		"a after CF.DEL CF.DEL ERR not found",
+		"a after pipeline 2",
+	}, events)
+
+	// a transaction completed by Do is a single pipeline
+	events = nil
+	conn := client.getConn()
+	assert.Nil(t, conn.Send("MULTI"))
+	assert.Nil(t, conn.Send("BF.ADD", "k", "a"))
+	reply, err := conn.Do("EXEC")
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", reply)
+	assert.Nil(t, conn.Close())
+	assert.Equal(t, "a before pipeline 3", events[0])
+	assert.Equal(t, "a after pipeline 3", events[len(events)-1])
+	assert.Equal(t, 8, len(events))
+
+	// replies not received are handed to the hooks on close
+	events = nil
+	conn = client.getConn()
+	assert.Nil(t, conn.Send("BF.ADD", "k", "a"))
+	assert.Nil(t, conn.Flush())
+	assert.Nil(t, conn.Close())
+	assert.Equal(t, "a after pipeline 1", events[len(events)-1])
+}
+
+func TestHooks_WithContext(t *testing.T) {
+	var seen interface{}
+	hook := &recordingHook{name: "a", events: new([]string), before: func(cmd *Command) error { return nil }}
+	client := &Client{Pool: &redistest.Pool{Reply: func(cmd string, args []interface{}) (interface{}, error) {
+		return int64(1), nil
+	}}, Hooks: []Hook{hook, contextHook{func(ctx context.Context) { seen = ctx.Value(hookCtxKey("user")) }}}}
+	ctx := context.WithValue(context.Background(), hookCtxKey("user"), "alice")
+	_, err := client.WithContext(ctx).Exists("filter", "a")
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", seen)
+	assert.Nil(t, client.ctx)
+}
+
+func TestClient_WithContextCanceled(t *testing.T) {
+	pool := &redistest.Pool{Reply: func(cmd string, args []interface{}) (interface{}, error) {
+		return int64(1), nil
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, local := range []*Client{
+		// without hooks, waiting for a connection gives up along with ctx
+		{Pool: pool},
+		// the commands of a pool without GetContext are canceled along with ctx
+		{Pool: valuePool{pool.Get}},
+		{Pool: valuePool{pool.Get}, Hooks: []Hook{contextHook{func(context.Context) {}}}},
+	} {
+		_, err := local.WithContext(ctx).Exists("filter", "a")
+		assert.Equal(t, context.Canceled, err)
+		_, err = local.WithContext(ctx).TdQuantilesMulti([]string{"a", "b"}, 0.5)
+		assert.NotNil(t, err)
+	}
+	assert.Equal(t, 0, len(pool.Sent("BF.EXISTS")))
+
+	// a pipeline whose replies are received after ctx is done
+	ctx, cancel = context.WithCancel(context.Background())
+	conn := (&Client{Pool: pool}).WithContext(ctx).getConn()
+	defer conn.Close()
+	assert.Nil(t, conn.Send("BF.ADD", "filter", "a"))
+	assert.Nil(t, conn.Flush())
+	cancel()
+	_, err := conn.Receive()
+	assert.Equal(t, context.Canceled, err)
+}
+
+// contextHook calls fn with the context of every command
+type contextHook struct {
+	fn func(ctx context.Context)
+}
+
+func (h contextHook) BeforeProcess(ctx context.Context, cmd *Command) (context.Context, error) {
+	h.fn(ctx)
+	return ctx, nil
+}
+
+func (h contextHook) AfterProcess(ctx context.Context, cmd *Command) error {
+	return cmd.Err
+}
+
+func (h contextHook) BeforeProcessPipeline(ctx context.Context, cmds []*Command) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h contextHook) AfterProcessPipeline(ctx context.Context, cmds []*Command) error {
+	return nil
+}
+
+func TestCommand_Describe(t *testing.T) {
+	count := func(name string, args ...interface{}) int {
+		n, ok := (&Command{Name: name, Args: args}).ItemCount()
+		if !ok {
+			return -1
+		}
+		return n
+	}
+	assert.Equal(t, 3, count("BF.MADD", "k", "a", "b", "c"))
+	assert.Equal(t, 2, count("CMS.INCRBY", "k", "a", 1, "b", 2))
+	assert.Equal(t, 1, count("CF.INSERTNX", "k", "CAPACITY", 100, "ITEMS", "a"))
+	assert.Equal(t, 2, count("BF.INSERT", "ITEMS", "NOCREATE", "ITEMS", "a", "b"))
+	assert.Equal(t, -1, count("BF.INFO", "k"))
+
+	key, ok := (&Command{Name: "EVALSHA", Args: []interface{}{"sha", 1, "key", "arg"}}).Key()
+	assert.True(t, ok)
+	assert.Equal(t, "key", key)
+	_, ok = (&Command{Name: "MULTI"}).Key()
+	assert.False(t, ok)
+	key, ok = (&Command{Name: "MEMORY", Args: []interface{}{"USAGE", []byte("key")}}).Key()
+	assert.True(t, ok)
+	assert.Equal(t, "key", key)
+
+	assert.Equal(t, "BF", (&Command{Name: "BF.MADD"}).Family())
+	assert.Equal(t, "TDIGEST", (&Command{Name: "tdigest.add"}).Family())
+	assert.Equal(t, "REDIS", (&Command{Name: "PEXPIREAT"}).Family())
+	assert.Equal(t, "REDIS", (&Command{Name: "FOO.BAR"}).Family())
+}
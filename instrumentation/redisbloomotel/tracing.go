@@ -0,0 +1,104 @@
+// Package redisbloomotel records OpenTelemetry spans for the commands of a RedisBloom client
+package redisbloomotel
+
+import (
+	"context"
+	"strings"
+
+	redisbloom "github.com/RedisBloom/redisbloom-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/RedisBloom/redisbloom-go/instrumentation/redisbloomotel"
+
+// redactedKey replaces the keys recorded on spans when TracingOptions.RedactKeys is set
+const redactedKey = "[redacted]"
+
+// TracingOptions configures the OpenTelemetry instrumentation of a redisbloom.Client
+type TracingOptions struct {
+	// TracerProvider creates the tracer spans are recorded with; the global provider is used when nil
+	TracerProvider trace.TracerProvider
+	// RedactKeys records "[redacted]" instead of the key of every command
+	RedactKeys bool
+}
+
+// Tracing is a redisbloom.Hook recording an OpenTelemetry span for every command a Client sends.
+// A span is named after its command and has the attributes db.system, db.operation, redisbloom.key and, for
+// multi-item commands, redisbloom.items. Commands pipelined on one connection, including MULTI/EXEC transactions,
+// are the children of a "pipeline" or "transaction" span. Errors, server errors included, are recorded on the spans.
+type Tracing struct {
+	tracer     trace.Tracer
+	redactKeys bool
+}
+
+// NewTracing creates a Tracing, to be added to redisbloom.Client.Hooks
+func NewTracing(opts TracingOptions) *Tracing {
+	provider := opts.TracerProvider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return &Tracing{tracer: provider.Tracer(tracerName), redactKeys: opts.RedactKeys}
+}
+
+// BeforeProcess starts the span of cmd
+func (t *Tracing) BeforeProcess(ctx context.Context, cmd *redisbloom.Command) (context.Context, error) {
+	attrs := []attribute.KeyValue{
+		attribute.String("db.system", "redis"),
+		attribute.String("db.operation", cmd.Name),
+	}
+	if key, ok := cmd.Key(); ok {
+		if t.redactKeys {
+			key = redactedKey
+		}
+		attrs = append(attrs, attribute.String("redisbloom.key", key))
+	}
+	if items, ok := cmd.ItemCount(); ok {
+		attrs = append(attrs, attribute.Int("redisbloom.items", items))
+	}
+	ctx, _ = t.tracer.Start(ctx, cmd.Name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	return ctx, nil
+}
+
+// AfterProcess ends the span of cmd, recording its error
+func (t *Tracing) AfterProcess(ctx context.Context, cmd *redisbloom.Command) error {
+	endSpan(trace.SpanFromContext(ctx), cmd.Err)
+	return cmd.Err
+}
+
+// BeforeProcessPipeline starts the span of a pipeline, named "transaction" when it starts with MULTI
+func (t *Tracing) BeforeProcessPipeline(ctx context.Context, cmds []*redisbloom.Command) (context.Context, error) {
+	name := "pipeline"
+	if len(cmds) > 0 && strings.EqualFold(cmds[0].Name, "MULTI") {
+		name = "transaction"
+	}
+	ctx, _ = t.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", "redis")))
+	return ctx, nil
+}
+
+// AfterProcessPipeline ends the span of a pipeline, marking it as failed when one of its commands failed
+func (t *Tracing) AfterProcessPipeline(ctx context.Context, cmds []*redisbloom.Command) error {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Int("redisbloom.commands", len(cmds)))
+	for _, cmd := range cmds {
+		if cmd.Err != nil {
+			span.SetStatus(codes.Error, "pipelined command failed")
+			break
+		}
+	}
+	span.End()
+	return nil
+}
+
+// endSpan ends span, recording err when not nil
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
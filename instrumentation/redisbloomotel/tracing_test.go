@@ -0,0 +1,114 @@
+package redisbloomotel
+
+import (
+	"context"
+	"testing"
+
+	redisbloom "github.com/RedisBloom/redisbloom-go"
+	"github.com/RedisBloom/redisbloom-go/internal/redistest"
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTracing(opts TracingOptions) (*Tracing, *tracetest.SpanRecorder) {
+	recorder := tracetest.NewSpanRecorder()
+	opts.TracerProvider = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	return NewTracing(opts), recorder
+}
+
+func newTracedClient(reply func(cmd string, args []interface{}) (interface{}, error), opts TracingOptions) (*redisbloom.Client, *tracetest.SpanRecorder) {
+	tracing, recorder := newTracing(opts)
+	return &redisbloom.Client{Pool: &redistest.Pool{Reply: reply}, Hooks: []redisbloom.Hook{tracing}}, recorder
+}
+
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, attr := range span.Attributes() {
+		attrs[attr.Key] = attr.Value
+	}
+	return attrs
+}
+
+func TestTracing_Command(t *testing.T) {
+	client, recorder := newTracedClient(func(cmd string, args []interface{}) (interface{}, error) {
+		if cmd == "CF.INFO" {
+			return nil, redis.Error("ERR not found")
+		}
+		return []interface{}{int64(1), int64(0)}, nil
+	}, TracingOptions{})
+	tracer := sdktrace.NewTracerProvider().Tracer("test")
+	ctx, parent := tracer.Start(context.Background(), "parent")
+
+	_, err := client.WithContext(ctx).BfInsert("filter", 100, 0, 0, false, false, []string{"a", "b"})
+	assert.Nil(t, err)
+	_, err = client.CfInfo("cuckoo")
+	assert.NotNil(t, err)
+
+	spans := recorder.Ended()
+	assert.Equal(t, 2, len(spans))
+	assert.Equal(t, "BF.INSERT", spans[0].Name())
+	assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent().SpanID())
+	attrs := spanAttributes(spans[0])
+	assert.Equal(t, "redis", attrs["db.system"].AsString())
+	assert.Equal(t, "BF.INSERT", attrs["db.operation"].AsString())
+	assert.Equal(t, "filter", attrs["redisbloom.key"].AsString())
+	assert.Equal(t, int64(2), attrs["redisbloom.items"].AsInt64())
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+
+	assert.Equal(t, "CF.INFO", spans[1].Name())
+	assert.False(t, spans[1].Parent().IsValid())
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	assert.Equal(t, 1, len(spans[1].Events()))
+}
+
+func TestTracing_Pipeline(t *testing.T) {
+	client, recorder := newTracedClient(func(cmd string, args []interface{}) (interface{}, error) {
+		if args[0] == "b" {
+			return redis.Error("ERR T-Digest: key does not exist"), nil
+		}
+		return []interface{}{[]byte("1")}, nil
+	}, TracingOptions{RedactKeys: true})
+	_, err := client.TdQuantilesMulti([]string{"a", "b"}, 0.5)
+	assert.NotNil(t, err)
+
+	spans := recorder.Ended()
+	assert.Equal(t, 3, len(spans))
+	pipeline := spans[2]
+	assert.Equal(t, "pipeline", pipeline.Name())
+	assert.Equal(t, codes.Error, pipeline.Status().Code)
+	assert.Equal(t, int64(2), spanAttributes(pipeline)["redisbloom.commands"].AsInt64())
+	for _, span := range spans[:2] {
+		assert.Equal(t, "TDIGEST.QUANTILE", span.Name())
+		assert.Equal(t, pipeline.SpanContext().SpanID(), span.Parent().SpanID())
+		assert.Equal(t, redactedKey, spanAttributes(span)["redisbloom.key"].AsString())
+	}
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+}
+
+func TestTracing_Transaction(t *testing.T) {
+	tracing, recorder := newTracing(TracingOptions{})
+	cmds := []*redisbloom.Command{{Name: "MULTI"}, {Name: "BF.ADD", Args: []interface{}{"filter", "a"}}, {Name: "EXEC"}}
+	ctx, err := tracing.BeforeProcessPipeline(context.Background(), cmds)
+	assert.Nil(t, err)
+	for _, cmd := range cmds {
+		cmdCtx, err := tracing.BeforeProcess(ctx, cmd)
+		assert.Nil(t, err)
+		assert.Nil(t, tracing.AfterProcess(cmdCtx, cmd))
+	}
+	assert.Nil(t, tracing.AfterProcessPipeline(ctx, cmds))
+
+	spans := recorder.Ended()
+	assert.Equal(t, 4, len(spans))
+	assert.Equal(t, "transaction", spans[3].Name())
+	for _, span := range spans[:3] {
+		assert.Equal(t, spans[3].SpanContext().SpanID(), span.Parent().SpanID())
+	}
+	assert.Equal(t, "EXEC", spans[2].Name())
+	_, ok := spanAttributes(spans[0])["redisbloom.key"]
+	assert.False(t, ok)
+}
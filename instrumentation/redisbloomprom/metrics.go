@@ -0,0 +1,184 @@
+// Package redisbloomprom exports Prometheus metrics about the commands and pool of a RedisBloom client
+package redisbloomprom
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+
+	redisbloom "github.com/RedisBloom/redisbloom-go"
+	"github.com/gomodule/redigo/redis"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MetricsOptions configures the Prometheus metrics of a redisbloom.Client
+type MetricsOptions struct {
+	// Registerer is the registry the metrics are registered with
+	Registerer prometheus.Registerer
+	// Namespace prefixes the metric names, "redisbloom" by default
+	Namespace string
+	// Buckets are the buckets of the latency histograms, in seconds; prometheus.DefBuckets by default
+	Buckets []float64
+	// Pool, when set, is the pool whose connection counts and wait times are exported.
+	// *redis.Pool, redisbloom.SingleHostPool and redisbloom.MultiHostPool are supported, the latter with one series
+	// per host.
+	Pool redisbloom.ConnPool
+}
+
+// Metrics is a redisbloom.Hook exporting Prometheus metrics about the commands a Client sends:
+//
+// - <namespace>_command_duration_seconds, a histogram of command latencies labeled by family and command.
+// The latency of a pipelined command runs from its flush to the reception of its reply.
+//
+// - <namespace>_command_errors_total, a counter of failed commands labeled by family, command and type, one of
+// server, timeout, connection, pool or other.
+//
+// - <namespace>_pool_active_connections, <namespace>_pool_idle_connections, <namespace>_pool_wait_total and
+// <namespace>_pool_wait_seconds_total, labeled by host, when a pool is given.
+//
+// The family label is BF, CF, CMS, TOPK or TDIGEST for RedisBloom commands, and REDIS for any other command.
+type Metrics struct {
+	latency *prometheus.HistogramVec
+	errors  *prometheus.CounterVec
+}
+
+// NewMetrics creates the metrics and registers them with opts.Registerer, to be added to redisbloom.Client.Hooks
+func NewMetrics(opts MetricsOptions) (*Metrics, error) {
+	if opts.Registerer == nil {
+		return nil, errors.New("a registerer is required")
+	}
+	namespace := opts.Namespace
+	if namespace == "" {
+		namespace = "redisbloom"
+	}
+	buckets := opts.Buckets
+	if buckets == nil {
+		buckets = prometheus.DefBuckets
+	}
+	m := &Metrics{
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "command_duration_seconds",
+			Help:      "Latency of RedisBloom commands.",
+			Buckets:   buckets,
+		}, []string{"family", "command"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "command_errors_total",
+			Help:      "Number of failed RedisBloom commands.",
+		}, []string{"family", "command", "type"}),
+	}
+	collectors := []prometheus.Collector{m.latency, m.errors}
+	if opts.Pool != nil {
+		collectors = append(collectors, newPoolCollector(namespace, opts.Pool))
+	}
+	for _, collector := range collectors {
+		if err := opts.Registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// observe records the latency of cmd and its error, when not nil
+func (m *Metrics) observe(cmd *redisbloom.Command) {
+	name, family := strings.ToUpper(cmd.Name), cmd.Family()
+	m.latency.WithLabelValues(family, name).Observe(cmd.Duration.Seconds())
+	if cmd.Err != nil {
+		m.errors.WithLabelValues(family, name, errorType(cmd.Err)).Inc()
+	}
+}
+
+// errorType classifies err for the type label of the error counter
+func errorType(err error) string {
+	if _, ok := err.(redis.Error); ok {
+		return "server"
+	}
+	if err == redis.ErrPoolExhausted {
+		return "pool"
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return "timeout"
+	}
+	if _, ok := err.(net.Error); ok || err == io.EOF || err == io.ErrUnexpectedEOF {
+		return "connection"
+	}
+	return "other"
+}
+
+// BeforeProcess does nothing, the latency of cmd is measured by the hook chain
+func (m *Metrics) BeforeProcess(ctx context.Context, cmd *redisbloom.Command) (context.Context, error) {
+	return ctx, nil
+}
+
+// AfterProcess records the latency of cmd and its error
+func (m *Metrics) AfterProcess(ctx context.Context, cmd *redisbloom.Command) error {
+	m.observe(cmd)
+	return cmd.Err
+}
+
+// BeforeProcessPipeline does nothing, pipelined commands are measured one by one
+func (m *Metrics) BeforeProcessPipeline(ctx context.Context, cmds []*redisbloom.Command) (context.Context, error) {
+	return ctx, nil
+}
+
+// AfterProcessPipeline does nothing, pipelined commands are measured one by one
+func (m *Metrics) AfterProcessPipeline(ctx context.Context, cmds []*redisbloom.Command) error {
+	return nil
+}
+
+// poolCollector exports the statistics of the redis.Pool instances behind a ConnPool
+type poolCollector struct {
+	pool        redisbloom.ConnPool
+	active      *prometheus.Desc
+	idle        *prometheus.Desc
+	waitCount   *prometheus.Desc
+	waitSeconds *prometheus.Desc
+}
+
+func newPoolCollector(namespace string, pool redisbloom.ConnPool) *poolCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "pool", name), help, []string{"host"}, nil)
+	}
+	return &poolCollector{
+		pool:        pool,
+		active:      desc("active_connections", "Number of connections of the pool, idle or in use."),
+		idle:        desc("idle_connections", "Number of idle connections of the pool."),
+		waitCount:   desc("wait_total", "Number of connections waited for."),
+		waitSeconds: desc("wait_seconds_total", "Total time spent waiting for a connection."),
+	}
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.active
+	ch <- c.idle
+	ch <- c.waitCount
+	ch <- c.waitSeconds
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	for host, stats := range poolStats(c.pool) {
+		ch <- prometheus.MustNewConstMetric(c.active, prometheus.GaugeValue, float64(stats.ActiveCount), host)
+		ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stats.IdleCount), host)
+		ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(stats.WaitCount), host)
+		ch <- prometheus.MustNewConstMetric(c.waitSeconds, prometheus.CounterValue, stats.WaitDuration.Seconds(), host)
+	}
+}
+
+// poolStats returns the statistics of the redis.Pool instances behind pool, by host.
+// The host of a single pool is unknown and reported as "".
+func poolStats(pool redisbloom.ConnPool) map[string]redis.PoolStats {
+	switch p := pool.(type) {
+	case *redis.Pool:
+		return map[string]redis.PoolStats{"": p.Stats()}
+	case *redisbloom.SingleHostPool:
+		return map[string]redis.PoolStats{"": p.Stats()}
+	case redisbloom.SingleHostPool:
+		return map[string]redis.PoolStats{"": p.Stats()}
+	case *redisbloom.MultiHostPool:
+		return p.Stats()
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package redisbloomprom
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	redisbloom "github.com/RedisBloom/redisbloom-go"
+	"github.com/RedisBloom/redisbloom-go/internal/redistest"
+	"github.com/gomodule/redigo/redis"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics_Commands(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics, err := NewMetrics(MetricsOptions{Registerer: registry})
+	assert.Nil(t, err)
+	client := &redisbloom.Client{Pool: &redistest.Pool{Reply: func(cmd string, args []interface{}) (interface{}, error) {
+		if cmd == "TOPK.LIST" {
+			return redis.Error("WRONGTYPE Operation against a key holding the wrong kind of value"), nil
+		}
+		return []interface{}{int64(1)}, nil
+	}}, Hooks: []redisbloom.Hook{metrics}}
+
+	_, err = client.BfAddMulti("filter", []string{"a"})
+	assert.Nil(t, err)
+	_, err = client.CmsQuery("sketch", []string{"a"})
+	assert.Nil(t, err)
+	w, err := redisbloom.NewWindowedTopK(client, "top", redisbloom.WindowedTopkOptions{Interval: time.Minute, Buckets: 2, TopK: 1})
+	assert.Nil(t, err)
+	_, err = w.Query(time.Minute)
+	assert.NotNil(t, err)
+
+	assert.Equal(t, 3, testutil.CollectAndCount(metrics.latency))
+	assert.Nil(t, testutil.CollectAndCompare(metrics.errors, strings.NewReader(`
+# HELP redisbloom_command_errors_total Number of failed RedisBloom commands.
+# TYPE redisbloom_command_errors_total counter
+redisbloom_command_errors_total{command="TOPK.LIST",family="TOPK",type="server"} 1
+`)))
+
+	_, err = NewMetrics(MetricsOptions{Registerer: registry})
+	assert.NotNil(t, err)
+	_, err = NewMetrics(MetricsOptions{})
+	assert.NotNil(t, err)
+}
+
+func TestMetrics_Pool(t *testing.T) {
+	// nothing listens on port 1, the connection attempt only creates the pool of the host
+	pool := redisbloom.NewMultiHostPool([]string{"127.0.0.1:1"}, nil)
+	pool.Get().Close()
+	registry := prometheus.NewRegistry()
+	_, err := NewMetrics(MetricsOptions{Registerer: registry, Namespace: "bloom", Pool: pool})
+	assert.Nil(t, err)
+	assert.Nil(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP bloom_pool_idle_connections Number of idle connections of the pool.
+# TYPE bloom_pool_idle_connections gauge
+bloom_pool_idle_connections{host="127.0.0.1:1"} 0
+`), "bloom_pool_idle_connections"))
+	assert.Equal(t, 1, len(poolStats(&redisbloom.SingleHostPool{Pool: &redis.Pool{}})))
+}
+
+func TestErrorType(t *testing.T) {
+	assert.Equal(t, "server", errorType(redis.Error("ERR")))
+	assert.Equal(t, "pool", errorType(redis.ErrPoolExhausted))
+	assert.Equal(t, "connection", errorType(io.EOF))
+	assert.Equal(t, "other", errorType(errors.New("oops")))
+}
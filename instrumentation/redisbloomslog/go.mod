@@ -0,0 +1,17 @@
+module github.com/RedisBloom/redisbloom-go/instrumentation/redisbloomslog
+
+go 1.21
+
+require (
+	github.com/RedisBloom/redisbloom-go v0.0.0-00010101000000-000000000000
+	github.com/gomodule/redigo v1.8.9
+	github.com/stretchr/testify v1.8.4
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace github.com/RedisBloom/redisbloom-go => ../..
@@ -0,0 +1,153 @@
+// Package redisbloomslog logs the commands of a RedisBloom client with log/slog
+package redisbloomslog
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+
+	redisbloom "github.com/RedisBloom/redisbloom-go"
+)
+
+// redactedKey replaces the keys logged when LoggingOptions.RedactKeys is set
+const redactedKey = "[redacted]"
+
+// LoggingOptions configures the slog logging of commands
+type LoggingOptions struct {
+	// Logger is the logger commands are logged with; slog.Default() is used when nil
+	Logger *slog.Logger
+	// Level is the level of successful commands. Failed commands are logged at slog.LevelError, or at Level when
+	// higher.
+	Level slog.Level
+	// SampleRate is the fraction of successful commands logged, all of them when 0. Failed commands are always
+	// logged.
+	SampleRate float64
+	// RedactKeys logs "[redacted]" instead of the key of every command
+	RedactKeys bool
+	// LogArgs logs the arguments following the key, up to MaxArgs of them, each truncated to MaxArgLength bytes.
+	// Without it only their number is logged.
+	LogArgs bool
+	// MaxArgs is the maximum number of arguments logged, 8 when 0
+	MaxArgs int
+	// MaxArgLength is the length arguments are truncated to, 32 when 0
+	MaxArgLength int
+}
+
+// Logging is a redisbloom.Hook logging every command with log/slog, as a "redisbloom command" record with the attributes
+// command, key, args (the number of arguments), items (for multi-item commands), values (the truncated arguments,
+// with LogArgs), pipelined, duration and error.
+type Logging struct {
+	logger *slog.Logger
+	opts   LoggingOptions
+	// sample returns a number in [0, 1) to compare with SampleRate
+	sample func() float64
+}
+
+// NewLogging creates a Logging, to be added to redisbloom.Client.Hooks
+func NewLogging(opts LoggingOptions) *Logging {
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if opts.MaxArgs == 0 {
+		opts.MaxArgs = 8
+	}
+	if opts.MaxArgLength == 0 {
+		opts.MaxArgLength = 32
+	}
+	return &Logging{logger: logger, opts: opts, sample: rand.Float64}
+}
+
+// BeforeProcess does nothing, commands are logged once they completed
+func (l *Logging) BeforeProcess(ctx context.Context, cmd *redisbloom.Command) (context.Context, error) {
+	return ctx, nil
+}
+
+// AfterProcess logs cmd, unless it succeeded and is not sampled
+func (l *Logging) AfterProcess(ctx context.Context, cmd *redisbloom.Command) error {
+	level := l.opts.Level
+	if cmd.Err != nil {
+		if level < slog.LevelError {
+			level = slog.LevelError
+		}
+	} else if l.opts.SampleRate > 0 && l.sample() >= l.opts.SampleRate {
+		return cmd.Err
+	}
+	if !l.logger.Enabled(ctx, level) {
+		return cmd.Err
+	}
+
+	attrs := make([]slog.Attr, 0, 8)
+	attrs = append(attrs, slog.String("command", cmd.Name))
+	args := cmd.Args
+	key, hasKey := cmd.Key()
+	if hasKey {
+		if len(args) > 0 && formatArg(args[0]) == key {
+			args = args[1:]
+		}
+		loggedKey := key
+		if l.opts.RedactKeys {
+			loggedKey = redactedKey
+		}
+		attrs = append(attrs, slog.String("key", loggedKey))
+	}
+	attrs = append(attrs, slog.Int("args", len(cmd.Args)))
+	if items, ok := cmd.ItemCount(); ok {
+		attrs = append(attrs, slog.Int("items", items))
+	}
+	if l.opts.LogArgs && len(args) > 0 {
+		values := l.truncateArgs(args)
+		if hasKey && l.opts.RedactKeys {
+			for i, value := range values {
+				if value == key {
+					values[i] = redactedKey
+				}
+			}
+		}
+		attrs = append(attrs, slog.Any("values", values))
+	}
+	attrs = append(attrs, slog.Bool("pipelined", cmd.Pipelined), slog.Duration("duration", cmd.Duration))
+	if cmd.Err != nil {
+		attrs = append(attrs, slog.String("error", cmd.Err.Error()))
+	}
+	l.logger.LogAttrs(ctx, level, "redisbloom command", attrs...)
+	return cmd.Err
+}
+
+// BeforeProcessPipeline does nothing, pipelined commands are logged one by one
+func (l *Logging) BeforeProcessPipeline(ctx context.Context, cmds []*redisbloom.Command) (context.Context, error) {
+	return ctx, nil
+}
+
+// AfterProcessPipeline does nothing, pipelined commands are logged one by one
+func (l *Logging) AfterProcessPipeline(ctx context.Context, cmds []*redisbloom.Command) error {
+	return nil
+}
+
+// truncateArgs formats the first MaxArgs args, truncated to MaxArgLength, and notes how many were left out
+func (l *Logging) truncateArgs(args []interface{}) []string {
+	n := len(args)
+	if n > l.opts.MaxArgs {
+		n = l.opts.MaxArgs
+	}
+	values := make([]string, 0, n+1)
+	for _, arg := range args[:n] {
+		value := formatArg(arg)
+		if len(value) > l.opts.MaxArgLength {
+			value = value[:l.opts.MaxArgLength] + "..."
+		}
+		values = append(values, value)
+	}
+	if len(args) > n {
+		values = append(values, "...")
+	}
+	return values
+}
+
+func formatArg(arg interface{}) string {
+	if b, ok := arg.([]byte); ok {
+		return string(b)
+	}
+	return fmt.Sprint(arg)
+}
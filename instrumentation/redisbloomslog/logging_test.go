@@ -0,0 +1,104 @@
+package redisbloomslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	redisbloom "github.com/RedisBloom/redisbloom-go"
+	"github.com/RedisBloom/redisbloom-go/internal/redistest"
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+// loggedRecords decodes the JSON records written to buf
+func loggedRecords(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		record := map[string]interface{}{}
+		assert.Nil(t, json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestLogging(t *testing.T) {
+	var buf bytes.Buffer
+	logging := NewLogging(LoggingOptions{
+		Logger:       slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		Level:        slog.LevelDebug,
+		LogArgs:      true,
+		MaxArgs:      2,
+		MaxArgLength: 4,
+		RedactKeys:   true,
+	})
+	client := &redisbloom.Client{Pool: &redistest.Pool{Reply: func(cmd string, args []interface{}) (interface{}, error) {
+		if cmd == "CF.INFO" {
+			return nil, redis.Error("ERR not found")
+		}
+		return []interface{}{int64(1), int64(1), int64(1)}, nil
+	}}, Hooks: []redisbloom.Hook{logging}}
+
+	_, err := client.BfAddMulti("filter", []string{"a", "abcdefgh", "c"})
+	assert.Nil(t, err)
+	_, err = client.CfInfo("cuckoo")
+	assert.NotNil(t, err)
+
+	records := loggedRecords(t, &buf)
+	assert.Equal(t, 2, len(records))
+	assert.Equal(t, "DEBUG", records[0]["level"])
+	assert.Equal(t, "redisbloom command", records[0]["msg"])
+	assert.Equal(t, "BF.MADD", records[0]["command"])
+	assert.Equal(t, redactedKey, records[0]["key"])
+	assert.Equal(t, float64(4), records[0]["args"])
+	assert.Equal(t, float64(3), records[0]["items"])
+	assert.Equal(t, []interface{}{"a", "abcd...", "..."}, records[0]["values"])
+	assert.Nil(t, records[0]["error"])
+
+	assert.Equal(t, "ERROR", records[1]["level"])
+	assert.Equal(t, "CF.INFO", records[1]["command"])
+	assert.Equal(t, "ERR not found", records[1]["error"])
+	assert.Nil(t, records[1]["values"])
+}
+
+func TestLogging_Sampling(t *testing.T) {
+	var buf bytes.Buffer
+	logging := NewLogging(LoggingOptions{
+		Logger:     slog.New(slog.NewJSONHandler(&buf, nil)),
+		SampleRate: 0.5,
+	})
+	samples := []float64{0.2, 0.7, 0.9}
+	logging.sample = func() float64 {
+		sample := samples[0]
+		samples = samples[1:]
+		return sample
+	}
+	failing := false
+	client := &redisbloom.Client{Pool: &redistest.Pool{Reply: func(cmd string, args []interface{}) (interface{}, error) {
+		if failing {
+			return nil, redis.Error("ERR")
+		}
+		return int64(1), nil
+	}}, Hooks: []redisbloom.Hook{logging}}
+
+	for i := 0; i < 2; i++ {
+		_, err := client.Add("filter", "a")
+		assert.Nil(t, err)
+	}
+	// failed commands are not sampled
+	failing = true
+	_, err := client.Add("filter", "a")
+	assert.NotNil(t, err)
+
+	records := loggedRecords(t, &buf)
+	assert.Equal(t, 2, len(records))
+	assert.Equal(t, "filter", records[0]["key"])
+	assert.Nil(t, records[0]["values"])
+	assert.Equal(t, "ERROR", records[1]["level"])
+	assert.Equal(t, []float64{0.9}, samples)
+}
@@ -0,0 +1,120 @@
+// Package redistest provides a fake connection pool for the tests of the client and of the instrumentation packages
+package redistest
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Pool is a connection pool whose connections record the commands they receive and answer them with Reply.
+// A redis.Error reply is returned as the error of the command. GetContext and the context methods of the
+// connections fail with the error of a done context, without recording anything.
+type Pool struct {
+	sync.Mutex
+	Reply    func(cmd string, args []interface{}) (interface{}, error)
+	Commands [][]interface{}
+	Conns    int
+}
+
+func (p *Pool) Get() redis.Conn {
+	p.Lock()
+	defer p.Unlock()
+	p.Conns++
+	return &conn{pool: p}
+}
+
+func (p *Pool) GetContext(ctx context.Context) (redis.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return p.Get(), nil
+}
+
+func (p *Pool) Close() error {
+	return nil
+}
+
+// Sent returns the recorded commands named name, in the order they were sent
+func (p *Pool) Sent(name string) [][]interface{} {
+	p.Lock()
+	defer p.Unlock()
+	var sent [][]interface{}
+	for _, command := range p.Commands {
+		if command[0] == name {
+			sent = append(sent, command)
+		}
+	}
+	return sent
+}
+
+type conn struct {
+	pool    *Pool
+	pending [][]interface{}
+}
+
+func (c *conn) record(cmd string, args []interface{}) []interface{} {
+	command := append([]interface{}{cmd}, args...)
+	c.pool.Lock()
+	defer c.pool.Unlock()
+	c.pool.Commands = append(c.pool.Commands, command)
+	return command
+}
+
+func (c *conn) reply(cmd string, args []interface{}) (interface{}, error) {
+	reply, err := c.pool.Reply(cmd, args)
+	if serverErr, ok := reply.(redis.Error); ok && err == nil {
+		err = serverErr
+	}
+	return reply, err
+}
+
+func (c *conn) Close() error { return nil }
+func (c *conn) Err() error   { return nil }
+func (c *conn) Flush() error { return nil }
+
+func (c *conn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if cmd == "" {
+		var replies []interface{}
+		for len(c.pending) > 0 {
+			reply, err := c.Receive()
+			if err != nil {
+				return nil, err
+			}
+			replies = append(replies, reply)
+		}
+		return replies, nil
+	}
+	c.record(cmd, args)
+	return c.reply(cmd, args)
+}
+
+func (c *conn) Send(cmd string, args ...interface{}) error {
+	c.pending = append(c.pending, c.record(cmd, args))
+	return nil
+}
+
+func (c *conn) DoContext(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.Do(cmd, args...)
+}
+
+func (c *conn) ReceiveContext(ctx context.Context) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.Receive()
+}
+
+func (c *conn) Receive() (interface{}, error) {
+	if len(c.pending) == 0 {
+		return nil, errors.New("no pending reply")
+	}
+	next := c.pending[0]
+	c.pending = c.pending[1:]
+	return c.reply(next[0].(string), next[1:])
+}
@@ -0,0 +1,261 @@
+package redis_bloom_go
+
+import (
+	"encoding"
+	"fmt"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// ItemCodec encodes the items given to the *Item and *Items variants of the BF, CF, CMS and TOPK commands
+type ItemCodec interface {
+	EncodeItem(item interface{}) ([]byte, error)
+}
+
+// ItemCodecFunc is an adapter to allow the use of ordinary functions as an ItemCodec
+type ItemCodecFunc func(item interface{}) ([]byte, error)
+
+// EncodeItem calls f(item)
+func (f ItemCodecFunc) EncodeItem(item interface{}) ([]byte, error) {
+	return f(item)
+}
+
+// ItemIncrement is a struct that represents an increment of a single CMS or Top-K item
+type ItemIncrement struct {
+	Item      interface{}
+	Increment int64
+}
+
+// encodeItem converts an item to a command argument.
+// When the client has an ItemCodec it is used for every item. Otherwise strings and []byte are sent as is,
+// so string items are encoded exactly as by the string based methods, encoding.BinaryMarshaler values are
+// sent as their binary form and integers, floats and booleans are formatted the way redigo formats them.
+func (client *Client) encodeItem(item interface{}) (interface{}, error) {
+	if client.ItemCodec != nil {
+		return client.ItemCodec.EncodeItem(item)
+	}
+	switch item := item.(type) {
+	case string, []byte,
+		int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64,
+		float32, float64, bool:
+		return item, nil
+	case encoding.BinaryMarshaler:
+		return item.MarshalBinary()
+	}
+	return nil, fmt.Errorf("unsupported item type %T, use []byte, encoding.BinaryMarshaler or an ItemCodec", item)
+}
+
+// addItems appends the encoded items to args
+func (client *Client) addItems(args redis.Args, items []interface{}) (redis.Args, error) {
+	for _, item := range items {
+		encoded, err := client.encodeItem(item)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, encoded)
+	}
+	return args, nil
+}
+
+// addItemIncrements appends the encoded item and increment pairs to args
+func (client *Client) addItemIncrements(args redis.Args, increments []ItemIncrement) (redis.Args, error) {
+	for _, incr := range increments {
+		encoded, err := client.encodeItem(incr.Item)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, encoded, incr.Increment)
+	}
+	return args, nil
+}
+
+// doItem runs a single item command, encoding the item first
+func (client *Client) doItem(cmd string, key string, item interface{}) (interface{}, error) {
+	args, err := client.addItems(redis.Args{key}, []interface{}{item})
+	if err != nil {
+		return nil, err
+	}
+	conn := client.getConn()
+	defer conn.Close()
+	return conn.Do(cmd, args...)
+}
+
+// doItems runs a multi item command, appending the encoded items to args
+func (client *Client) doItems(cmd string, args redis.Args, items []interface{}) (interface{}, error) {
+	args, err := client.addItems(args, items)
+	if err != nil {
+		return nil, err
+	}
+	conn := client.getConn()
+	defer conn.Close()
+	return conn.Do(cmd, args...)
+}
+
+// doChunkedItems runs a chunked multi item command, see doChunked
+func (client *Client) doChunkedItems(cmd string, prefix redis.Args, items []interface{}) ([]interface{}, error) {
+	args, err := client.addItems(make(redis.Args, 0, len(items)), items)
+	if err != nil {
+		return nil, err
+	}
+	return client.doChunked(cmd, prefix, args)
+}
+
+// doItemIncrements runs an increment command, appending the encoded item and increment pairs to the key
+func (client *Client) doItemIncrements(cmd string, key string, increments []ItemIncrement) (interface{}, error) {
+	args, err := client.addItemIncrements(redis.Args{key}, increments)
+	if err != nil {
+		return nil, err
+	}
+	conn := client.getConn()
+	defer conn.Close()
+	return conn.Do(cmd, args...)
+}
+
+// AddItem - Add (or create and add) a new item of any supported type to the filter
+func (client *Client) AddItem(key string, item interface{}) (bool, error) {
+	return redis.Bool(client.doItem("BF.ADD", key, item))
+}
+
+// ExistsItem - Determines whether an item of any supported type may exist in the Bloom Filter or not.
+func (client *Client) ExistsItem(key string, item interface{}) (bool, error) {
+	return redis.Bool(client.doItem("BF.EXISTS", key, item))
+}
+
+// BfAddMultiItems - Adds one or more items of any supported type to the Bloom Filter, creating the filter
+// if it does not yet exist.
+// Large item lists are chunked as configured by client.Chunking, see ChunkOptions: on error, the items of the
+// chunks already applied remain added.
+func (client *Client) BfAddMultiItems(key string, items []interface{}) ([]int64, error) {
+	return redis.Int64s(client.doChunkedItems("BF.MADD", redis.Args{key}, items))
+}
+
+// BfExistsMultiItems - Determines if one or more items of any supported type may exist in the filter or not.
+// Large item lists are chunked as configured by client.Chunking, see ChunkOptions.
+func (client *Client) BfExistsMultiItems(key string, items []interface{}) ([]int64, error) {
+	return redis.Int64s(client.doChunkedItems("BF.MEXISTS", redis.Args{key}, items))
+}
+
+// BfInsertItems - Adds one or more items of any supported type to the bloom filter, by default creating it
+// if it does not yet exist.
+// Large item lists are chunked as configured by client.Chunking, see ChunkOptions: on error, the items of the
+// chunks already applied remain added.
+func (client *Client) BfInsertItems(key string, cap int64, errorRatio float64, expansion int64, noCreate bool, nonScaling bool, items []interface{}) ([]int64, error) {
+	args := getBfInsertArgs(key, cap, errorRatio, expansion, noCreate, nonScaling)
+	return redis.Int64s(client.doChunkedItems("BF.INSERT", args, items))
+}
+
+// CfAddItem - Adds an item of any supported type to the cuckoo filter, creating the filter if it does not exist.
+func (client *Client) CfAddItem(key string, item interface{}) (bool, error) {
+	return redis.Bool(client.doItem("CF.ADD", key, item))
+}
+
+// CfAddNxItem - Adds an item of any supported type to a cuckoo filter if the item did not exist previously.
+func (client *Client) CfAddNxItem(key string, item interface{}) (bool, error) {
+	return redis.Bool(client.doItem("CF.ADDNX", key, item))
+}
+
+// CfInsertItems - Adds one or more items of any supported type to a cuckoo filter, allowing the filter to be
+// created with a custom capacity if it does not yet exist.
+// Large item lists are chunked as configured by client.Chunking, see ChunkOptions: on error, the items of the
+// chunks already applied remain added.
+func (client *Client) CfInsertItems(key string, cap int64, noCreate bool, items []interface{}) ([]int64, error) {
+	return redis.Int64s(client.doChunkedItems("CF.INSERT", GetInsertArgs(key, cap, noCreate, nil), items))
+}
+
+// CfInsertNxItems - Adds one or more items of any supported type to a cuckoo filter if they did not exist
+// previously, allowing the filter to be created with a custom capacity if it does not yet exist.
+// Large item lists are chunked as configured by client.Chunking, see ChunkOptions: on error, the items of the
+// chunks already applied remain added.
+func (client *Client) CfInsertNxItems(key string, cap int64, noCreate bool, items []interface{}) ([]int64, error) {
+	return redis.Int64s(client.doChunkedItems("CF.INSERTNX", GetInsertArgs(key, cap, noCreate, nil), items))
+}
+
+// CfExistsItem - Check if an item of any supported type exists in a Cuckoo Filter
+func (client *Client) CfExistsItem(key string, item interface{}) (bool, error) {
+	return redis.Bool(client.doItem("CF.EXISTS", key, item))
+}
+
+// CfDelItem - Deletes an item of any supported type once from the filter.
+func (client *Client) CfDelItem(key string, item interface{}) (bool, error) {
+	return redis.Bool(client.doItem("CF.DEL", key, item))
+}
+
+// CfCountItem - Returns the number of times an item of any supported type may be in the filter.
+func (client *Client) CfCountItem(key string, item interface{}) (int64, error) {
+	return redis.Int64(client.doItem("CF.COUNT", key, item))
+}
+
+// CmsIncrByItems - Increases the count of items of any supported type by their increment.
+// The results follow the order of increments.
+func (client *Client) CmsIncrByItems(key string, increments []ItemIncrement) ([]int64, error) {
+	return redis.Int64s(client.doItemIncrements("CMS.INCRBY", key, increments))
+}
+
+// CmsQueryItems - Returns count for items of any supported type.
+// Large item lists are chunked as configured by client.Chunking, see ChunkOptions.
+func (client *Client) CmsQueryItems(key string, items []interface{}) ([]int64, error) {
+	return redis.Int64s(client.doChunkedItems("CMS.QUERY", redis.Args{key}, items))
+}
+
+// TopkAddItems - Adds items of any supported type to the data structure, reporting for every item whether
+// another item was expelled from the list and which one. The Item of every result is the item as sent.
+// Large item lists are chunked as configured by client.Chunking, see ChunkOptions: on error, the items of the
+// chunks already applied remain added.
+func (client *Client) TopkAddItems(key string, items []interface{}) ([]TopkAddResult, error) {
+	args, err := client.addItems(redis.Args{}, items)
+	if err != nil {
+		return nil, err
+	}
+	values, err := client.doChunked("TOPK.ADD", redis.Args{key}, args)
+	if err != nil {
+		return nil, err
+	}
+	return client.topkExpelled(key, itemNames(args, 1), values)
+}
+
+// TopkIncrByItems - Increase the score of items of any supported type by their increment, reporting for every
+// increment whether another item was expelled from the list and which one. The results follow the order of
+// increments.
+func (client *Client) TopkIncrByItems(key string, increments []ItemIncrement) ([]TopkAddResult, error) {
+	args, err := client.addItemIncrements(redis.Args{}, increments)
+	if err != nil {
+		return nil, err
+	}
+	conn := client.getConn()
+	defer conn.Close()
+	values, err := redis.Values(conn.Do("TOPK.INCRBY", append(redis.Args{key}, args...)...))
+	if err != nil {
+		return nil, err
+	}
+	return client.topkExpelled(key, itemNames(args, 2), values)
+}
+
+// topkExpelled decodes the reply to TOPK.ADD or TOPK.INCRBY and notifies the expulsions
+func (client *Client) topkExpelled(key string, items []string, values []interface{}) ([]TopkAddResult, error) {
+	results, err := ParseTopkAddReply(items, values)
+	if err != nil {
+		return nil, err
+	}
+	client.notifyTopkExpelled(key, results)
+	return results, nil
+}
+
+// itemNames formats every stride-th encoded item of args the way it is sent to the server
+func itemNames(args redis.Args, stride int) []string {
+	names := make([]string, 0, len(args)/stride)
+	for i := 0; i < len(args); i += stride {
+		names = append(names, formatResp3Arg(args[i]))
+	}
+	return names
+}
+
+// TopkQueryItems - Checks whether items of any supported type are among the Top-K items.
+func (client *Client) TopkQueryItems(key string, items []interface{}) ([]int64, error) {
+	return redis.Int64s(client.doItems("TOPK.QUERY", redis.Args{key}, items))
+}
+
+// TopkCountItems - Returns count for items of any supported type.
+func (client *Client) TopkCountItems(key string, items []interface{}) ([]int64, error) {
+	return redis.Int64s(client.doItems("TOPK.COUNT", redis.Args{key}, items))
+}
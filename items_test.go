@@ -0,0 +1,166 @@
+package redis_bloom_go
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/RedisBloom/redisbloom-go/internal/redistest"
+	"github.com/stretchr/testify/assert"
+)
+
+type binaryID [4]byte
+
+func (id binaryID) MarshalBinary() ([]byte, error) {
+	return id[:], nil
+}
+
+func TestClient_encodeItem(t *testing.T) {
+	c := &Client{}
+	encoded, err := c.encodeItem("item")
+	assert.Nil(t, err)
+	assert.Equal(t, "item", encoded)
+	encoded, err = c.encodeItem([]byte{0, 1, 2})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0, 1, 2}, encoded)
+	encoded, err = c.encodeItem(int64(42))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(42), encoded)
+	encoded, err = c.encodeItem(binaryID{0xde, 0xad, 0xbe, 0xef})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0xde, 0xad, 0xbe, 0xef}, encoded)
+	_, err = c.encodeItem(struct{}{})
+	assert.NotNil(t, err)
+
+	c.ItemCodec = ItemCodecFunc(func(item interface{}) ([]byte, error) {
+		if s, ok := item.(string); ok {
+			return []byte("prefix:" + s), nil
+		}
+		return nil, errors.New("not a string")
+	})
+	encoded, err = c.encodeItem("item")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("prefix:item"), encoded)
+	_, err = c.encodeItem(1)
+	assert.NotNil(t, err)
+}
+
+func TestClient_BfItems(t *testing.T) {
+	client.FlushAll()
+	key := "test_bf_items"
+	id := binaryID{0, 0xff, 0, 0xff}
+	added, err := client.AddItem(key, id)
+	assert.Nil(t, err)
+	assert.True(t, added)
+	exists, err := client.ExistsItem(key, []byte{0, 0xff, 0, 0xff})
+	assert.Nil(t, err)
+	assert.True(t, exists)
+
+	// string items are encoded exactly like the string based methods
+	ret, err := client.BfAddMultiItems(key, []interface{}{"a", []byte("b"), 42})
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1, 1, 1}, ret)
+	ret, err = client.BfExistsMulti(key, []string{"a", "b", "42", "c"})
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1, 1, 1, 0}, ret)
+	ret, err = client.BfExistsMultiItems(key, []interface{}{"a", []byte("c")})
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1, 0}, ret)
+
+	ret, err = client.BfInsertItems("test_bf_insert_items", 1000, 0.01, -1, false, false, []interface{}{[]byte{0}, []byte{0}})
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1, 0}, ret)
+
+	_, err = client.BfAddMultiItems(key, []interface{}{struct{}{}})
+	assert.NotNil(t, err)
+}
+
+func TestClient_CfItems(t *testing.T) {
+	client.FlushAll()
+	key := "test_cf_items"
+	item := []byte{1, 2, 3}
+	ret, err := client.CfAddItem(key, item)
+	assert.Nil(t, err)
+	assert.True(t, ret)
+	ret, err = client.CfAddNxItem(key, item)
+	assert.Nil(t, err)
+	assert.False(t, ret)
+	count, err := client.CfCountItem(key, item)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+	ret, err = client.CfExistsItem(key, item)
+	assert.Nil(t, err)
+	assert.True(t, ret)
+	ret, err = client.CfDelItem(key, item)
+	assert.Nil(t, err)
+	assert.True(t, ret)
+
+	inserted, err := client.CfInsertItems(key, 1000, false, []interface{}{item, "a"})
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1, 1}, inserted)
+	inserted, err = client.CfInsertNxItems(key, 1000, false, []interface{}{item, "b"})
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{0, 1}, inserted)
+	exists, err := client.CfExists(key, "b")
+	assert.Nil(t, err)
+	assert.True(t, exists)
+}
+
+func TestClient_CmsItems(t *testing.T) {
+	client.FlushAll()
+	key := "test_cms_items"
+	ret, err := client.CmsInitByDim(key, 1000, 5)
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", ret)
+	counts, err := client.CmsIncrByItems(key, []ItemIncrement{{[]byte{0xff}, 3}, {"a", 5}})
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{3, 5}, counts)
+	counts, err = client.CmsQueryItems(key, []interface{}{[]byte{0xff}, "b"})
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{3, 0}, counts)
+	counts, err = client.CmsQuery(key, []string{"a"})
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{5}, counts)
+}
+
+func TestClient_TopkItems(t *testing.T) {
+	client.FlushAll()
+	key := "test_topk_items"
+	ret, err := client.TopkReserve(key, 10, 2000, 7, 0.925)
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", ret)
+	results, err := client.TopkAddItems(key, []interface{}{[]byte{0}, "a"})
+	assert.Nil(t, err)
+	assert.Equal(t, []TopkAddResult{{Item: "\x00"}, {Item: "a"}}, results)
+	results, err = client.TopkIncrByItems(key, []ItemIncrement{{[]byte{0}, 5}})
+	assert.Nil(t, err)
+	assert.Equal(t, []TopkAddResult{{Item: "\x00"}}, results)
+	counts, err := client.TopkCountItems(key, []interface{}{[]byte{0}, "a"})
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{6, 1}, counts)
+	query, err := client.TopkQueryItems(key, []interface{}{[]byte{0}, "b"})
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1, 0}, query)
+}
+
+func TestClient_TopkItemsExpelledFake(t *testing.T) {
+	// the first item expels nothing and the second the item stored under the empty string
+	pool := &redistest.Pool{Reply: func(cmd string, args []interface{}) (interface{}, error) {
+		return []interface{}{nil, []byte("")}, nil
+	}}
+	var notified []TopkAddResult
+	c := &Client{Pool: pool, TopkExpelledHandler: func(key string, result TopkAddResult) {
+		notified = append(notified, result)
+	}}
+	results, err := c.TopkAddItems("key", []interface{}{int64(1), true})
+	assert.Nil(t, err)
+	assert.Equal(t, []TopkAddResult{{Item: "1"}, {Item: "1", Expelled: true, ExpelledItem: ""}}, results)
+	assert.Equal(t, results[1:], notified)
+
+	results, err = c.TopkIncrByItems("key", []ItemIncrement{{[]byte("a"), 2}, {2.5, 1}})
+	assert.Nil(t, err)
+	assert.Equal(t, []TopkAddResult{{Item: "a"}, {Item: "2.5", Expelled: true}}, results)
+	assert.Equal(t, []interface{}{"TOPK.INCRBY", "key", []byte("a"), int64(2), 2.5, int64(1)}, pool.Commands[1])
+
+	_, err = c.TopkAddItems("key", []interface{}{"a"})
+	assert.IsType(t, &ReplyError{}, err)
+}
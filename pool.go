@@ -1,6 +1,7 @@
 package redis_bloom_go
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"sync"
@@ -14,6 +15,27 @@ type ConnPool interface {
 	Close() error
 }
 
+// KeyedPool is a ConnPool that can also return a connection to the node serving a given key, such as a pool
+// aware of the slots of a Redis Cluster
+type KeyedPool interface {
+	ConnPool
+	GetForKey(key string) redis.Conn
+}
+
+// keyPool is a ConnPool whose connections all go to the node serving key. Closing it leaves pool open.
+type keyPool struct {
+	pool KeyedPool
+	key  string
+}
+
+func (p keyPool) Get() redis.Conn {
+	return p.pool.GetForKey(p.key)
+}
+
+func (p keyPool) Close() error {
+	return nil
+}
+
 type SingleHostPool struct {
 	*redis.Pool
 }
@@ -38,6 +60,8 @@ type MultiHostPool struct {
 	pools    map[string]*redis.Pool
 	hosts    []string
 	authPass *string
+	// dial creates the dial function of the pool of a host, dialFuncWrapper when nil
+	dial func(host string, authPass *string) func() (redis.Conn, error)
 }
 
 func (p *MultiHostPool) Close() (err error) {
@@ -70,18 +94,52 @@ func (p *MultiHostPool) Get() redis.Conn {
 	defer p.Unlock()
 
 	host := p.hosts[rand.Intn(len(p.hosts))]
+	return p.hostPool(host).Get()
+}
+
+// GetContext is like Get, giving up waiting for the connection when ctx is done
+func (p *MultiHostPool) GetContext(ctx context.Context) (redis.Conn, error) {
+	p.Lock()
+	pool := p.hostPool(p.hosts[rand.Intn(len(p.hosts))])
+	p.Unlock()
+	return pool.GetContext(ctx)
+}
+
+// hostPool returns the pool of host, creating it on first use; p must be locked
+func (p *MultiHostPool) hostPool(host string) *redis.Pool {
 	pool, found := p.pools[host]
 
 	if !found {
+		dial := p.dial
+		if dial == nil {
+			dial = dialFuncWrapper
+		}
 		pool = &redis.Pool{
-			Dial:         dialFuncWrapper(host, p.authPass),
+			Dial:         dial(host, p.authPass),
 			TestOnBorrow: testOnBorrow,
 			MaxIdle:      maxConns,
 		}
 		p.pools[host] = pool
 	}
+	return pool
+}
 
-	return pool.Get()
+// Stats returns the statistics of the pool of every host connected to so far, by host
+func (p *MultiHostPool) Stats() map[string]redis.PoolStats {
+	p.Lock()
+	defer p.Unlock()
+	stats := make(map[string]redis.PoolStats, len(p.pools))
+	for host, pool := range p.pools {
+		stats[host] = pool.Stats()
+	}
+	return stats
+}
+
+// getHost returns a connection to host
+func (p *MultiHostPool) getHost(host string) redis.Conn {
+	p.Lock()
+	defer p.Unlock()
+	return p.hostPool(host).Get()
 }
 
 func dialFuncWrapper(host string, authPass *string) func() (redis.Conn, error) {
@@ -94,3 +94,10 @@ func TestMultiHostPool_Close(t *testing.T) {
 		})
 	}
 }
+
+func TestMultiHostPool_Stats(t *testing.T) {
+	pool := NewMultiHostPool([]string{"a:6379", "b:6379"}, nil)
+	assert.Equal(t, map[string]redis.PoolStats{}, pool.Stats())
+	pool.pools["a:6379"] = &redis.Pool{}
+	assert.Equal(t, map[string]redis.PoolStats{"a:6379": {}}, pool.Stats())
+}
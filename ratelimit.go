@@ -0,0 +1,103 @@
+package redis_bloom_go
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// RateLimiterOptions configures a CmsRateLimiter
+type RateLimiterOptions struct {
+	// Interval is the length of the fixed windows requests are counted over
+	Interval time.Duration
+	// Width and Depth are the dimensions of the sketch of every window, see CmsInitByDim. The estimated count
+	// of an identifier exceeds its real count by at most 2/Width of all the requests of the window, with a
+	// probability of at least 1-2^-Depth.
+	Width int64
+	Depth int64
+}
+
+// RateLimitResult is a struct that represents the outcome of a rate limit check
+type RateLimitResult struct {
+	// Allowed tells whether the request fits in the limit, in which case it was counted
+	Allowed bool
+	// Count is the estimated number of requests of the identifier in the current window, this one included if allowed
+	Count int64
+	// Limit is the limit the request was checked against
+	Limit int64
+	// Remaining is the number of requests still allowed in the current window
+	Remaining int64
+	// ResetAfter is the time until the current window ends and the count starts over
+	ResetAfter time.Duration
+}
+
+// rateLimitScript creates the sketch of the window if needed, and increments the count of the identifier only
+// when the request fits in the limit, so that concurrent checks can not overshoot it.
+// KEYS[1] is the sketch, ARGV is width, depth, expiry in Unix milliseconds, identifier, limit and cost.
+var rateLimitScript = redis.NewScript(1, `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	redis.call('CMS.INITBYDIM', KEYS[1], ARGV[1], ARGV[2])
+	redis.call('PEXPIREAT', KEYS[1], ARGV[3])
+end
+local count = redis.call('CMS.QUERY', KEYS[1], ARGV[4])[1]
+local cost = tonumber(ARGV[6])
+if count + cost > tonumber(ARGV[5]) then
+	return {0, count}
+end
+count = redis.call('CMS.INCRBY', KEYS[1], ARGV[4], cost)[1]
+return {1, count}
+`)
+
+// CmsRateLimiter limits the number of requests per identifier over fixed windows, using one Count-Min Sketch per
+// window stored under prefix:<window number>, so memory stays bounded however many identifiers there are.
+// The check and the increment run atomically in a server side script. Since a sketch only overestimates counts,
+// an identifier never gets more than its limit, but may be denied early when the sketch is too small for the
+// traffic of a window.
+type CmsRateLimiter struct {
+	client *Client
+	opts   RateLimiterOptions
+	window timeWindow
+}
+
+// NewCmsRateLimiter creates a CmsRateLimiter storing its sketches under prefix
+func NewCmsRateLimiter(client *Client, prefix string, opts RateLimiterOptions) (*CmsRateLimiter, error) {
+	if opts.Width < 1 || opts.Depth < 1 {
+		return nil, errors.New("width and depth must be positive")
+	}
+	window, err := newTimeWindow(prefix, opts.Interval, 1)
+	if err != nil {
+		return nil, err
+	}
+	return &CmsRateLimiter{client: client, opts: opts, window: window}, nil
+}
+
+// Allow checks one request of id against limit requests per window, counting it if allowed
+func (l *CmsRateLimiter) Allow(id string, limit int64) (RateLimitResult, error) {
+	return l.AllowN(id, limit, 1)
+}
+
+// AllowN checks a request of cost n of id against limit per window, counting it if allowed
+func (l *CmsRateLimiter) AllowN(id string, limit int64, n int64) (RateLimitResult, error) {
+	bucket := l.window.current()
+	key := l.window.key(bucket)
+	conn := l.client.getConn()
+	defer conn.Close()
+	values, err := redis.Int64s(rateLimitScript.Do(conn, key, l.opts.Width, l.opts.Depth, l.window.expireAt(bucket), id, limit, n))
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	if len(values) != 2 {
+		return RateLimitResult{}, replyDecoder{"EVALSHA"}.errorf("expects 2 values, got %d", len(values))
+	}
+	result := RateLimitResult{
+		Allowed:    values[0] == 1,
+		Count:      values[1],
+		Limit:      limit,
+		ResetAfter: l.window.resetIn(bucket),
+	}
+	if result.Count < limit {
+		result.Remaining = limit - result.Count
+	}
+	return result, nil
+}
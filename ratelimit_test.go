@@ -0,0 +1,95 @@
+package redis_bloom_go
+
+import (
+	"testing"
+	"time"
+
+	"github.com/RedisBloom/redisbloom-go/internal/redistest"
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+// rateLimitServer runs rateLimitScript over exact per window counts
+func rateLimitServer(counts map[string]int64) func(cmd string, args []interface{}) (interface{}, error) {
+	return func(cmd string, args []interface{}) (interface{}, error) {
+		if cmd != "EVALSHA" && cmd != "EVAL" {
+			return nil, redis.Error("ERR unknown command")
+		}
+		key := args[2].(string) + "/" + args[6].(string)
+		limit, cost := args[7].(int64), args[8].(int64)
+		if counts[key]+cost > limit {
+			return []interface{}{int64(0), counts[key]}, nil
+		}
+		counts[key] += cost
+		return []interface{}{int64(1), counts[key]}, nil
+	}
+}
+
+func TestCmsRateLimiter_AllowFake(t *testing.T) {
+	counts := map[string]int64{}
+	l, err := NewCmsRateLimiter(&Client{Pool: &redistest.Pool{Reply: rateLimitServer(counts)}}, "rl", RateLimiterOptions{Interval: time.Minute, Width: 100, Depth: 4})
+	assert.Nil(t, err)
+	now := time.Unix(10*60+15, 0)
+	l.window.now = fakeClock(&now)
+
+	result, err := l.AllowN("user", 5, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, RateLimitResult{Allowed: true, Count: 2, Limit: 5, Remaining: 3, ResetAfter: 45 * time.Second}, result)
+	result, err = l.AllowN("user", 5, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, RateLimitResult{Allowed: true, Count: 5, Limit: 5, ResetAfter: 45 * time.Second}, result)
+	// a denied request is not counted
+	result, err = l.Allow("user", 5)
+	assert.Nil(t, err)
+	assert.Equal(t, RateLimitResult{Count: 5, Limit: 5, ResetAfter: 45 * time.Second}, result)
+	assert.Equal(t, int64(5), counts["rl:10/user"])
+	// other identifiers have limits of their own
+	result, err = l.Allow("other", 5)
+	assert.Nil(t, err)
+	assert.True(t, result.Allowed)
+
+	// the count starts over with the next window
+	now = now.Add(time.Minute)
+	result, err = l.Allow("user", 5)
+	assert.Nil(t, err)
+	assert.Equal(t, RateLimitResult{Allowed: true, Count: 1, Limit: 5, Remaining: 4, ResetAfter: 45 * time.Second}, result)
+}
+
+func TestCmsRateLimiter_InvalidOptions(t *testing.T) {
+	_, err := NewCmsRateLimiter(&Client{}, "rl", RateLimiterOptions{Interval: time.Minute})
+	assert.NotNil(t, err)
+	_, err = NewCmsRateLimiter(&Client{}, "rl", RateLimiterOptions{Width: 100, Depth: 4})
+	assert.NotNil(t, err)
+}
+
+func TestCmsRateLimiter(t *testing.T) {
+	client.FlushAll()
+	l, err := NewCmsRateLimiter(client, "test_rate_limit", RateLimiterOptions{Interval: time.Minute, Width: 1000, Depth: 5})
+	assert.Nil(t, err)
+	now := time.Now()
+	l.window.now = fakeClock(&now)
+
+	for i := int64(1); i <= 3; i++ {
+		result, err := l.Allow("user", 3)
+		assert.Nil(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, i, result.Count)
+		assert.Equal(t, 3-i, result.Remaining)
+		assert.True(t, result.ResetAfter > 0 && result.ResetAfter <= time.Minute)
+	}
+	result, err := l.Allow("user", 3)
+	assert.Nil(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, int64(3), result.Count)
+	result, err = l.AllowN("other", 3, 4)
+	assert.Nil(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, int64(0), result.Count)
+
+	// the next window starts over
+	now = now.Add(time.Minute)
+	result, err = l.Allow("user", 3)
+	assert.Nil(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, int64(1), result.Count)
+}
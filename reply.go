@@ -0,0 +1,208 @@
+package redis_bloom_go
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// ReplyError is returned when the reply to a command does not have the expected shape
+type ReplyError struct {
+	// Command is the command whose reply is malformed, empty when unknown
+	Command string
+	// Reason describes what is unexpected in the reply
+	Reason string
+}
+
+func (e *ReplyError) Error() string {
+	if e.Command == "" {
+		return "unexpected reply: " + e.Reason
+	}
+	return fmt.Sprintf("unexpected %s reply: %s", e.Command, e.Reason)
+}
+
+// replyDecoder converts the reply to cmd, returning a *ReplyError instead of panicking when it does not have the
+// expected shape. Errors of the command itself, server errors included, and redis.ErrNil are returned unchanged.
+type replyDecoder struct {
+	cmd string
+}
+
+func (d replyDecoder) errorf(format string, args ...interface{}) error {
+	return &ReplyError{Command: d.cmd, Reason: fmt.Sprintf(format, args...)}
+}
+
+// check turns the error of a redigo conversion into a *ReplyError
+func (d replyDecoder) check(err error) error {
+	switch err.(type) {
+	case nil, redis.Error, *ReplyError:
+		return err
+	}
+	if err == redis.ErrNil {
+		return err
+	}
+	return &ReplyError{Command: d.cmd, Reason: err.Error()}
+}
+
+func (d replyDecoder) values(reply interface{}, err error) ([]interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	values, err := redis.Values(reply, nil)
+	return values, d.check(err)
+}
+
+// pairs decodes field/value pairs, a flat RESP2 array or a RESP3 map
+func (d replyDecoder) pairs(reply interface{}, err error) ([]interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	values, err := replyPairs(reply, nil)
+	if err != nil {
+		return nil, d.check(err)
+	}
+	if len(values)%2 != 0 {
+		return nil, d.errorf("expects even number of values, got %d", len(values))
+	}
+	return values, nil
+}
+
+// field decodes the name of a field of a pairs reply
+func (d replyDecoder) field(reply interface{}) (string, error) {
+	switch reply := reply.(type) {
+	case []byte:
+		return string(reply), nil
+	case string:
+		return reply, nil
+	}
+	return "", d.errorf("field name has type %T", reply)
+}
+
+// int64 decodes an integer, what naming it in errors. RESP3 doubles holding whole numbers, which some module
+// versions reply with for integer fields, are accepted.
+func (d replyDecoder) int64(what string, reply interface{}) (int64, error) {
+	switch reply := reply.(type) {
+	case int64:
+		return reply, nil
+	case []byte:
+		n, err := strconv.ParseInt(string(reply), 10, 64)
+		if err != nil {
+			return 0, d.errorf("%s is not an integer: %q", what, reply)
+		}
+		return n, nil
+	case float64:
+		if reply != math.Trunc(reply) {
+			return 0, d.errorf("%s is not an integer: %v", what, reply)
+		}
+		if reply >= 1<<63 || reply < -(1<<63) {
+			return 0, d.errorf("%s overflows an int64: %v", what, reply)
+		}
+		return int64(reply), nil
+	case nil:
+		return 0, redis.ErrNil
+	case redis.Error:
+		return 0, reply
+	}
+	return 0, d.errorf("%s has type %T, expected an integer", what, reply)
+}
+
+func (d replyDecoder) string(what string, reply interface{}) (string, error) {
+	s, err := redis.String(reply, nil)
+	if err != nil && err != redis.ErrNil {
+		if _, ok := err.(redis.Error); !ok {
+			return "", d.errorf("%s has type %T, expected a string", what, reply)
+		}
+	}
+	return s, err
+}
+
+// info decodes field/value pairs with integer values, leaving out the fields whose value is null, such as the
+// expansion rate of a non scaling Bloom filter
+func (d replyDecoder) info(reply interface{}, err error) (map[string]int64, error) {
+	values, err := d.pairs(reply, err)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]int64, len(values)/2)
+	for i := 0; i < len(values); i += 2 {
+		field, err := d.field(values[i])
+		if err != nil {
+			return nil, err
+		}
+		if values[i+1] == nil {
+			continue
+		}
+		m[field], err = d.int64(field, values[i+1])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// topkInfo decodes a TOPK.INFO reply, formatting the values as strings
+func (d replyDecoder) topkInfo(reply interface{}, err error) (map[string]string, error) {
+	values, err := d.pairs(reply, err)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]string, len(values)/2)
+	for i := 0; i < len(values); i += 2 {
+		field, err := d.field(values[i])
+		if err != nil {
+			return nil, err
+		}
+		switch v := values[i+1].(type) {
+		case []byte:
+			m[field] = string(v)
+		case int64:
+			m[field] = strconv.FormatInt(v, 10)
+		case float64:
+			m[field] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return nil, d.errorf("%s has type %T, expected a string or a number", field, v)
+		}
+	}
+	return m, nil
+}
+
+// float64 decodes a TDIGEST double
+func (d replyDecoder) float64(reply interface{}, err error) (float64, error) {
+	if err != nil {
+		return 0, err
+	}
+	f, err := tdFloat64(reply, nil)
+	return f, d.check(err)
+}
+
+// float64s decodes an array of TDIGEST doubles
+func (d replyDecoder) float64s(reply interface{}, err error) ([]float64, error) {
+	if err != nil {
+		return nil, err
+	}
+	f, err := tdFloat64s(reply, nil)
+	return f, d.check(err)
+}
+
+// scanDump decodes the iterator and data chunk of a SCANDUMP reply, the data being nil once the dump is over
+func (d replyDecoder) scanDump(reply interface{}, err error) (int64, []byte, error) {
+	values, err := d.values(reply, err)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(values) != 2 {
+		return 0, nil, d.errorf("expects 2 values, got %d", len(values))
+	}
+	iter, err := d.int64("iterator", values[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	switch data := values[1].(type) {
+	case nil:
+		return iter, nil, nil
+	case []byte:
+		return iter, data, nil
+	}
+	return 0, nil, d.errorf("data has type %T, expected a bulk string", values[1])
+}
@@ -0,0 +1,181 @@
+package redis_bloom_go
+
+import (
+	"math"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplyDecoder_ScanDump(t *testing.T) {
+	d := replyDecoder{"BF.SCANDUMP"}
+	iter, data, err := d.scanDump([]interface{}{int64(1), []byte("chunk")}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), iter)
+	assert.Equal(t, []byte("chunk"), data)
+
+	iter, data, err = d.scanDump([]interface{}{int64(0), nil}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), iter)
+	assert.Nil(t, data)
+
+	_, _, err = d.scanDump([]interface{}{"1", []byte("chunk")}, nil)
+	assert.Equal(t, &ReplyError{Command: "BF.SCANDUMP", Reason: "iterator has type string, expected an integer"}, err)
+	assert.Equal(t, "unexpected BF.SCANDUMP reply: iterator has type string, expected an integer", err.Error())
+
+	_, _, err = d.scanDump([]interface{}{int64(1), int64(2)}, nil)
+	assert.Equal(t, "unexpected BF.SCANDUMP reply: data has type int64, expected a bulk string", err.Error())
+
+	_, _, err = d.scanDump([]interface{}{int64(1)}, nil)
+	assert.Equal(t, "unexpected BF.SCANDUMP reply: expects 2 values, got 1", err.Error())
+
+	_, _, err = d.scanDump("OK", nil)
+	assert.IsType(t, &ReplyError{}, err)
+
+	// server errors are returned unchanged
+	_, _, err = d.scanDump(nil, redis.Error("WRONGTYPE"))
+	assert.Equal(t, redis.Error("WRONGTYPE"), err)
+	_, _, err = d.scanDump(redis.Error("WRONGTYPE"), nil)
+	assert.Equal(t, redis.Error("WRONGTYPE"), err)
+}
+
+func TestReplyDecoder_Info(t *testing.T) {
+	d := replyDecoder{"CMS.INFO"}
+	info, err := d.info([]interface{}{"width", int64(2000), []byte("depth"), []byte("5")}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int64{"width": 2000, "depth": 5}, info)
+
+	_, err = d.info([]interface{}{int64(1), int64(2)}, nil)
+	assert.Equal(t, "unexpected CMS.INFO reply: field name has type int64", err.Error())
+	_, err = d.info([]interface{}{"width", []interface{}{}}, nil)
+	assert.Equal(t, "unexpected CMS.INFO reply: width has type []interface {}, expected an integer", err.Error())
+	_, err = d.info([]interface{}{"width"}, nil)
+	assert.Equal(t, "unexpected CMS.INFO reply: expects even number of values, got 1", err.Error())
+	_, err = ParseInfoReply([]interface{}{"width", 2.5}, nil)
+	assert.Equal(t, "unexpected reply: width is not an integer: 2.5", err.Error())
+}
+
+func TestReplyDecoder_Int64(t *testing.T) {
+	d := replyDecoder{"CMS.INFO"}
+	n, err := d.int64("width", float64(2000))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2000), n)
+	n, err = d.int64("width", float64(-(1 << 63)))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(math.MinInt64), n)
+
+	_, err = d.int64("width", float64(1<<63))
+	assert.Equal(t, &ReplyError{Command: "CMS.INFO", Reason: "width overflows an int64: 9.223372036854776e+18"}, err)
+	_, err = d.int64("width", -1e19)
+	assert.IsType(t, &ReplyError{}, err)
+	_, err = d.int64("width", math.Inf(1))
+	assert.IsType(t, &ReplyError{}, err)
+	_, err = d.int64("width", math.NaN())
+	assert.IsType(t, &ReplyError{}, err)
+	_, err = d.int64("width", 2.5)
+	assert.Equal(t, "unexpected CMS.INFO reply: width is not an integer: 2.5", err.Error())
+}
+
+func TestReplyDecoder_TopkInfo(t *testing.T) {
+	d := replyDecoder{"TOPK.INFO"}
+	info, err := d.topkInfo([]interface{}{"k", int64(10), "decay", []byte("0.9")}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"k": "10", "decay": "0.9"}, info)
+
+	_, err = d.topkInfo([]interface{}{[]interface{}{}, int64(10)}, nil)
+	assert.IsType(t, &ReplyError{}, err)
+	_, err = d.topkInfo([]interface{}{"k", nil}, nil)
+	assert.Equal(t, "unexpected TOPK.INFO reply: k has type <nil>, expected a string or a number", err.Error())
+}
+
+func TestReplyDecoder_Float64s(t *testing.T) {
+	d := replyDecoder{"TDIGEST.QUANTILE"}
+	_, err := d.float64s([]interface{}{[]interface{}{}}, nil)
+	assert.Equal(t, "unexpected TDIGEST.QUANTILE reply: TDIGEST double has type []interface {}", err.Error())
+	_, err = d.float64("OK", nil)
+	assert.IsType(t, &ReplyError{}, err)
+	_, err = d.float64(nil, nil)
+	assert.Equal(t, redis.ErrNil, err)
+}
+
+// decodeAll runs the reply through every parser, checking they fail with a *ReplyError, a server error or
+// redis.ErrNil rather than panicking
+func decodeAll(t *testing.T, reply interface{}) {
+	check := func(err error) {
+		switch err.(type) {
+		case nil, *ReplyError, redis.Error:
+			return
+		}
+		if err != redis.ErrNil {
+			t.Fatalf("unexpected error %T: %v", err, err)
+		}
+	}
+	d := replyDecoder{"TEST"}
+	_, _, err := d.scanDump(reply, nil)
+	check(err)
+	_, err = d.info(reply, nil)
+	check(err)
+	_, err = d.topkInfo(reply, nil)
+	check(err)
+	_, err = d.float64(reply, nil)
+	check(err)
+	_, err = d.float64s(reply, nil)
+	check(err)
+	_, err = ParseTDigestInfo(reply, nil)
+	check(err)
+	if values, ok := reply.([]interface{}); ok {
+		_, err = ParseTopkListWithCount(values, nil)
+		check(err)
+		_, err = ParseInfoReply(values, nil)
+		check(err)
+		_, err = ParseTopkAddReply(make([]string, len(values)), values)
+		check(err)
+	}
+}
+
+func FuzzReplyParsers(f *testing.F) {
+	for _, seed := range []string{
+		"*2\r\n:1\r\n$5\r\nchunk\r\n",
+		"*2\r\n:0\r\n$-1\r\n",
+		"*4\r\n+width\r\n:2000\r\n+depth\r\n:5\r\n",
+		"%2\r\n+k\r\n:10\r\n+decay\r\n,0.9\r\n",
+		"%1\r\n+Compression\r\n,100\r\n",
+		"*3\r\n,1.5\r\n$3\r\ninf\r\n_\r\n",
+		"*2\r\n$1\r\na\r\n#t\r\n",
+		"~1\r\n*1\r\n%0\r\n",
+		"-ERR unknown command\r\n",
+		",nan\r\n",
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		conn, _ := newCannedResp3Conn(string(data))
+		for i := 0; i < 8; i++ {
+			reply, err := conn.readReply()
+			if err != nil {
+				return
+			}
+			decodeAll(t, reply)
+		}
+	})
+}
+
+func TestReplyParsers_Corpus(t *testing.T) {
+	// announced lengths far beyond the data, which must fail without allocating them upfront
+	for _, data := range []string{
+		"$2147483647\r\n",
+		"*2147483647\r\n",
+		"%2147483647\r\n",
+		"$9223372036854775807\r\n",
+		"*1\r\n*1\r\n*1\r\n:1\r\n",
+		"=3\r\ntxt\r\n",
+	} {
+		conn, _ := newCannedResp3Conn(data)
+		reply, err := conn.readReply()
+		if err == nil {
+			decodeAll(t, reply)
+		}
+	}
+}
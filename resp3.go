@@ -0,0 +1,588 @@
+package redis_bloom_go
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Resp3DialOption specifies an option for dialing a RESP3 connection, like redis.DialOption for redis.Dial
+type Resp3DialOption func(*resp3DialOptions)
+
+type resp3DialOptions struct {
+	connectTimeout, readTimeout, writeTimeout time.Duration
+}
+
+// Resp3DialConnectTimeout specifies the timeout for connecting to the server, none by default
+func Resp3DialConnectTimeout(d time.Duration) Resp3DialOption {
+	return func(o *resp3DialOptions) { o.connectTimeout = d }
+}
+
+// Resp3DialReadTimeout specifies the timeout for reading a single reply, none by default
+func Resp3DialReadTimeout(d time.Duration) Resp3DialOption {
+	return func(o *resp3DialOptions) { o.readTimeout = d }
+}
+
+// Resp3DialWriteTimeout specifies the timeout for writing a single command, none by default
+func Resp3DialWriteTimeout(d time.Duration) Resp3DialOption {
+	return func(o *resp3DialOptions) { o.writeTimeout = d }
+}
+
+// DialResp3 connects to the server at address and switches the connection to the RESP3 protocol with HELLO 3,
+// authenticating as the default user when authPass is not nil. It requires Redis 6 or later.
+//
+// Replies are decoded the way redigo decodes RESP2 ones, with the RESP3 types mapped as follows: maps to
+// map[string]interface{}, sets to []interface{}, doubles to float64, booleans to int64 1 or 0, nulls to nil, big
+// numbers to []byte and verbatim strings to their text as []byte. Attributes are skipped, and so are push
+// messages, such as the invalidations of client side caching, which are not replies to a command.
+// The connection implements redis.ConnWithTimeout and redis.ConnWithContext.
+func DialResp3(network, address string, authPass *string, options ...Resp3DialOption) (redis.Conn, error) {
+	var opts resp3DialOptions
+	for _, option := range options {
+		option(&opts)
+	}
+	netConn, err := net.DialTimeout(network, address, opts.connectTimeout)
+	if err != nil {
+		return nil, err
+	}
+	conn := newResp3Conn(netConn)
+	conn.readTimeout, conn.writeTimeout = opts.readTimeout, opts.writeTimeout
+	args := redis.Args{3}
+	if authPass != nil {
+		args = args.Add("AUTH", "default", *authPass)
+	}
+	if _, err := conn.Do("HELLO", args...); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("HELLO 3: %v", err)
+	}
+	return conn, nil
+}
+
+// NewResp3SingleHostPool is NewSingleHostPool with connections speaking RESP3, dialed with options
+func NewResp3SingleHostPool(host string, authPass *string, options ...Resp3DialOption) *SingleHostPool {
+	pool := NewSingleHostPool(host, authPass)
+	pool.Dial = resp3DialFuncWrapper(options)(host, authPass)
+	return pool
+}
+
+// NewResp3MultiHostPool is NewMultiHostPool with connections speaking RESP3, dialed with options
+func NewResp3MultiHostPool(hosts []string, authPass *string, options ...Resp3DialOption) *MultiHostPool {
+	pool := NewMultiHostPool(hosts, authPass)
+	pool.dial = resp3DialFuncWrapper(options)
+	return pool
+}
+
+func resp3DialFuncWrapper(options []Resp3DialOption) func(host string, authPass *string) func() (redis.Conn, error) {
+	return func(host string, authPass *string) func() (redis.Conn, error) {
+		return func() (redis.Conn, error) {
+			return DialResp3("tcp", host, authPass, options...)
+		}
+	}
+}
+
+// resp3Conn is a redis.Conn speaking RESP3, mirroring the pipelining and timeout behavior of redigo connections
+type resp3Conn struct {
+	conn    io.ReadWriteCloser
+	br      *bufio.Reader
+	bw      *bufio.Writer
+	pending int
+	// readTimeout and writeTimeout bound every read and write when conn is a net.Conn, none when 0
+	readTimeout, writeTimeout time.Duration
+
+	mu  sync.Mutex
+	err error
+}
+
+func newResp3Conn(conn io.ReadWriteCloser) *resp3Conn {
+	return &resp3Conn{conn: conn, br: bufio.NewReader(conn), bw: bufio.NewWriter(conn)}
+}
+
+func (c *resp3Conn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		c.err = errors.New("redisbloom: closed")
+	}
+	return c.conn.Close()
+}
+
+func (c *resp3Conn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// fatal records err as the error of the connection, which is unusable from then on
+func (c *resp3Conn) fatal(err error) error {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = err
+		c.conn.Close()
+	}
+	c.mu.Unlock()
+	return err
+}
+
+func (c *resp3Conn) Send(cmd string, args ...interface{}) error {
+	if err := c.Err(); err != nil {
+		return err
+	}
+	if err := c.writeCommand(cmd, args); err != nil {
+		return c.fatal(err)
+	}
+	c.pending++
+	return nil
+}
+
+func (c *resp3Conn) Flush() error {
+	if err := c.Err(); err != nil {
+		return err
+	}
+	if err := c.flush(); err != nil {
+		return c.fatal(err)
+	}
+	return nil
+}
+
+// flush writes the buffered commands within the write timeout
+func (c *resp3Conn) flush() error {
+	if netConn, ok := c.conn.(net.Conn); ok && c.writeTimeout > 0 {
+		if err := netConn.SetWriteDeadline(time.Now().Add(c.writeTimeout)); err != nil {
+			return err
+		}
+	}
+	return c.bw.Flush()
+}
+
+// setReadTimeout bounds the reads of the next reply by timeout, clearing the deadline when 0
+func (c *resp3Conn) setReadTimeout(timeout time.Duration) error {
+	netConn, ok := c.conn.(net.Conn)
+	if !ok {
+		return nil
+	}
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	return netConn.SetReadDeadline(deadline)
+}
+
+func (c *resp3Conn) Receive() (interface{}, error) {
+	return c.ReceiveWithTimeout(c.readTimeout)
+}
+
+// ReceiveWithTimeout is Receive with timeout in place of the read timeout of the connection
+func (c *resp3Conn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	if err := c.Err(); err != nil {
+		return nil, err
+	}
+	if err := c.setReadTimeout(timeout); err != nil {
+		return nil, c.fatal(err)
+	}
+	reply, err := c.readResponse()
+	if err != nil {
+		return nil, c.fatal(err)
+	}
+	if c.pending > 0 {
+		c.pending--
+	}
+	if serverErr, ok := reply.(redis.Error); ok {
+		return nil, serverErr
+	}
+	return reply, nil
+}
+
+// Do sends cmd and returns its reply after the replies of the pending commands, like redigo: the first server
+// error of the pending commands is returned along with the last reply, and Do("") returns all the pending
+// replies, server errors included, with a nil error.
+func (c *resp3Conn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	return c.DoWithTimeout(c.readTimeout, cmd, args...)
+}
+
+// DoWithTimeout is Do with timeout in place of the read timeout of the connection
+func (c *resp3Conn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	if err := c.Err(); err != nil {
+		return nil, err
+	}
+	if cmd != "" {
+		if err := c.writeCommand(cmd, args); err != nil {
+			return nil, c.fatal(err)
+		}
+	}
+	if err := c.flush(); err != nil {
+		return nil, c.fatal(err)
+	}
+	pending := c.pending
+	c.pending = 0
+	if err := c.setReadTimeout(timeout); err != nil {
+		return nil, c.fatal(err)
+	}
+
+	if cmd == "" {
+		replies := make([]interface{}, pending)
+		for i := range replies {
+			reply, err := c.readResponse()
+			if err != nil {
+				return nil, c.fatal(err)
+			}
+			replies[i] = reply
+		}
+		return replies, nil
+	}
+
+	var reply interface{}
+	var err error
+	for i := 0; i <= pending; i++ {
+		var readErr error
+		if reply, readErr = c.readResponse(); readErr != nil {
+			return nil, c.fatal(readErr)
+		}
+		if serverErr, ok := reply.(redis.Error); ok && err == nil {
+			err = serverErr
+		}
+	}
+	return reply, err
+}
+
+// DoContext is Do, giving up once ctx is done. The read timeout is shortened to the deadline of ctx, if any.
+// A command given up leaves the connection unusable, as with redigo.
+func (c *resp3Conn) DoContext(ctx context.Context, cmd string, args ...interface{}) (reply interface{}, err error) {
+	err = c.withContext(ctx, func(timeout time.Duration) error {
+		reply, err = c.DoWithTimeout(timeout, cmd, args...)
+		return err
+	})
+	return reply, err
+}
+
+// ReceiveContext is Receive, giving up once ctx is done, see DoContext
+func (c *resp3Conn) ReceiveContext(ctx context.Context) (reply interface{}, err error) {
+	err = c.withContext(ctx, func(timeout time.Duration) error {
+		reply, err = c.ReceiveWithTimeout(timeout)
+		return err
+	})
+	return reply, err
+}
+
+// withContext runs fn with the read timeout of the connection, bounded by the deadline of ctx. When ctx is done
+// before fn returns, the deadlines of the connection are moved to now to interrupt its reads and writes, and
+// the error of ctx is returned, as it is when fn times out on the deadline of ctx.
+func (c *resp3Conn) withContext(ctx context.Context, fn func(timeout time.Duration) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	timeout, ctxTimeout := c.readTimeout, false
+	if deadline, ok := ctx.Deadline(); ok {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return context.DeadlineExceeded
+		}
+		if timeout == 0 || remaining < timeout {
+			timeout, ctxTimeout = remaining, true
+		}
+	}
+	run := func() error {
+		err := fn(timeout)
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() && ctxTimeout {
+			return context.DeadlineExceeded
+		}
+		return err
+	}
+	netConn, ok := c.conn.(net.Conn)
+	if !ok || ctx.Done() == nil {
+		return run()
+	}
+
+	stop := make(chan struct{})
+	interrupted := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			netConn.SetDeadline(time.Now())
+			interrupted <- true
+		case <-stop:
+			interrupted <- false
+		}
+	}()
+	err := run()
+	close(stop)
+	if <-interrupted {
+		if err != nil {
+			return ctx.Err()
+		}
+		// fn completed before the deadlines moved, restore them for the next commands
+		netConn.SetDeadline(time.Time{})
+	}
+	return err
+}
+
+// writeCommand writes cmd and its arguments as an array of bulk strings, formatting the arguments like redigo
+func (c *resp3Conn) writeCommand(cmd string, args []interface{}) error {
+	c.bw.WriteString("*" + strconv.Itoa(len(args)+1) + "\r\n")
+	err := c.writeBulk(cmd)
+	for _, arg := range args {
+		if err != nil {
+			break
+		}
+		err = c.writeBulk(formatResp3Arg(arg))
+	}
+	return err
+}
+
+func formatResp3Arg(arg interface{}) string {
+	switch arg := arg.(type) {
+	case string:
+		return arg
+	case []byte:
+		return string(arg)
+	case int:
+		return strconv.Itoa(arg)
+	case int64:
+		return strconv.FormatInt(arg, 10)
+	case float64:
+		return strconv.FormatFloat(arg, 'g', -1, 64)
+	case bool:
+		if arg {
+			return "1"
+		}
+		return "0"
+	case nil:
+		return ""
+	case redis.Argument:
+		return formatResp3Arg(arg.RedisArg())
+	}
+	return fmt.Sprint(arg)
+}
+
+// writeBulk writes s as a bulk string, returning the first error of the writes to the connection
+func (c *resp3Conn) writeBulk(s string) error {
+	c.bw.WriteString("$" + strconv.Itoa(len(s)) + "\r\n")
+	c.bw.WriteString(s)
+	_, err := c.bw.WriteString("\r\n")
+	return err
+}
+
+// protocolError is a malformed reply, after which the connection is closed
+type protocolError string
+
+func (e protocolError) Error() string {
+	return "redisbloom: " + string(e) + " (possible server error or unsupported concurrent read by application)"
+}
+
+func (c *resp3Conn) readLine() ([]byte, error) {
+	line, err := c.br.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		// a line longer than the buffer, such as a long simple string
+		full := append([]byte(nil), line...)
+		for err == bufio.ErrBufferFull {
+			line, err = c.br.ReadSlice('\n')
+			full = append(full, line...)
+		}
+		line = full
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, protocolError("bad response line terminator")
+	}
+	return line[:len(line)-2], nil
+}
+
+// readLength parses the length of an aggregate or blob, -1 standing for the RESP2 null
+func readLength(p []byte) (int, error) {
+	n, err := strconv.Atoi(string(p))
+	if err != nil || n < -1 || n > math.MaxInt32 {
+		return 0, protocolError("bad length " + strconv.Quote(string(p)))
+	}
+	return n, nil
+}
+
+// maxPrealloc bounds the memory allocated upfront for a blob or an aggregate, whose announced length a malformed
+// reply could inflate
+const maxPrealloc = 1 << 16
+
+func (c *resp3Conn) readBlob(n int) ([]byte, error) {
+	var p []byte
+	if n+2 <= maxPrealloc {
+		p = make([]byte, n+2)
+		if _, err := io.ReadFull(c.br, p); err != nil {
+			return nil, err
+		}
+	} else {
+		var buf bytes.Buffer
+		if _, err := io.CopyN(&buf, c.br, int64(n)+2); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		p = buf.Bytes()
+	}
+	if p[n] != '\r' || p[n+1] != '\n' {
+		return nil, protocolError("bad bulk string format")
+	}
+	return p[:n], nil
+}
+
+// pushMessage is a RESP3 push frame, which the server sends out of band rather than in reply to a command
+type pushMessage []interface{}
+
+// readResponse reads the reply to a command, skipping the push messages that precede it
+func (c *resp3Conn) readResponse() (interface{}, error) {
+	for {
+		reply, err := c.readReply()
+		if _, ok := reply.(pushMessage); !ok || err != nil {
+			return reply, err
+		}
+	}
+}
+
+func (c *resp3Conn) readReply() (interface{}, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, protocolError("short response line")
+	}
+	// line points into the read buffer, which the reads of a blob or of the elements of an aggregate overwrite
+	kind := line[0]
+	switch kind {
+	case '+':
+		return string(line[1:]), nil
+	case '-':
+		return redis.Error(line[1:]), nil
+	case ':':
+		n, err := strconv.ParseInt(string(line[1:]), 10, 64)
+		if err != nil {
+			return nil, protocolError("bad integer " + strconv.Quote(string(line[1:])))
+		}
+		return n, nil
+	case ',':
+		f, err := parseTdFloat(string(line[1:]))
+		if err != nil {
+			return nil, protocolError("bad double " + strconv.Quote(string(line[1:])))
+		}
+		return f, nil
+	case '#':
+		switch string(line[1:]) {
+		case "t":
+			return int64(1), nil
+		case "f":
+			return int64(0), nil
+		}
+		return nil, protocolError("bad boolean " + strconv.Quote(string(line[1:])))
+	case '_':
+		return nil, nil
+	case '(':
+		return append([]byte(nil), line[1:]...), nil
+	case '$', '!', '=':
+		n, err := readLength(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		p, err := c.readBlob(n)
+		if err != nil {
+			return nil, err
+		}
+		switch kind {
+		case '!':
+			return redis.Error(p), nil
+		case '=':
+			// the text follows a three letter format, such as txt:
+			if len(p) < 4 || p[3] != ':' {
+				return nil, protocolError("bad verbatim string format")
+			}
+			return p[4:], nil
+		}
+		return p, nil
+	case '*', '~', '>':
+		n, err := readLength(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		values := make([]interface{}, 0, prealloc(n))
+		for i := 0; i < n; i++ {
+			value, err := c.readReply()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		if kind == '>' {
+			return pushMessage(values), nil
+		}
+		return values, nil
+	case '%', '|':
+		n, err := readLength(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		m := make(map[string]interface{}, prealloc(n))
+		for i := 0; i < n; i++ {
+			key, err := c.readReply()
+			if err != nil {
+				return nil, err
+			}
+			value, err := c.readReply()
+			if err != nil {
+				return nil, err
+			}
+			m[mapKey(key)] = value
+		}
+		if kind == '|' {
+			// attributes annotate the reply that follows them
+			return c.readReply()
+		}
+		return m, nil
+	}
+	return nil, protocolError("unexpected response line " + strconv.Quote(string(line)))
+}
+
+// prealloc returns the capacity to allocate for an aggregate of n elements
+func prealloc(n int) int {
+	if n > maxPrealloc {
+		return maxPrealloc
+	}
+	return n
+}
+
+// mapKey formats a key of a RESP3 map
+func mapKey(key interface{}) string {
+	switch key := key.(type) {
+	case []byte:
+		return string(key)
+	case string:
+		return key
+	}
+	return fmt.Sprint(key)
+}
+
+// replyPairs is a helper that converts a reply made of field/value pairs, a flat RESP2 array or a RESP3 map, to
+// a flat array. The fields of a map are sorted.
+func replyPairs(reply interface{}, err error) ([]interface{}, error) {
+	if m, ok := reply.(map[string]interface{}); ok && err == nil {
+		keys := make([]string, 0, len(m))
+		for key := range m {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		values := make([]interface{}, 0, 2*len(m))
+		for _, key := range keys {
+			values = append(values, key, m[key])
+		}
+		return values, nil
+	}
+	return redis.Values(reply, err)
+}
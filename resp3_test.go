@@ -0,0 +1,299 @@
+package redis_bloom_go
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"math"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RedisBloom/redisbloom-go/internal/redistest"
+	"github.com/gomodule/redigo/redis"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// cannedConn replays canned RESP3 replies and records what is written to it
+type cannedConn struct {
+	*strings.Reader
+	written bytes.Buffer
+	closed  bool
+}
+
+func (c *cannedConn) Write(p []byte) (int, error) { return c.written.Write(p) }
+func (c *cannedConn) Close() error                { c.closed = true; return nil }
+
+func newCannedResp3Conn(replies string) (*resp3Conn, *cannedConn) {
+	canned := &cannedConn{Reader: strings.NewReader(replies)}
+	return newResp3Conn(canned), canned
+}
+
+func TestResp3Conn_Replies(t *testing.T) {
+	conn, _ := newCannedResp3Conn("+OK\r\n" +
+		":42\r\n" +
+		"$5\r\nhello\r\n" +
+		"$-1\r\n" +
+		"_\r\n" +
+		",3.25\r\n" +
+		",inf\r\n" +
+		"#t\r\n" +
+		"#f\r\n" +
+		"(3492890328409238509324850943850943825024385\r\n" +
+		"=15\r\ntxt:Some string\r\n" +
+		"*2\r\n:1\r\n$1\r\na\r\n" +
+		"~1\r\n+x\r\n" +
+		"%2\r\n+Capacity\r\n:100\r\n$5\r\nDecay\r\n,0.9\r\n" +
+		"|1\r\n+ttl\r\n:3600\r\n:7\r\n")
+
+	expected := []interface{}{
+		"OK",
+		int64(42),
+		[]byte("hello"),
+		nil,
+		nil,
+		3.25,
+		math.Inf(1),
+		int64(1),
+		int64(0),
+		[]byte("3492890328409238509324850943850943825024385"),
+		[]byte("Some string"),
+		[]interface{}{int64(1), []byte("a")},
+		[]interface{}{"x"},
+		map[string]interface{}{"Capacity": int64(100), "Decay": 0.9},
+		int64(7),
+	}
+	for _, want := range expected {
+		reply, err := conn.Receive()
+		assert.Nil(t, err)
+		assert.Equal(t, want, reply)
+	}
+}
+
+func TestResp3Conn_Errors(t *testing.T) {
+	conn, _ := newCannedResp3Conn("-ERR simple\r\n!10\r\nERR bulk e\r\n")
+	_, err := conn.Receive()
+	assert.Equal(t, redis.Error("ERR simple"), err)
+	_, err = conn.Receive()
+	assert.Equal(t, redis.Error("ERR bulk e"), err)
+	// server errors leave the connection usable
+	assert.Nil(t, conn.Err())
+
+	conn, canned := newCannedResp3Conn("?oops\r\n")
+	_, err = conn.Receive()
+	assert.IsType(t, protocolError(""), err)
+	assert.Equal(t, err, conn.Err())
+	assert.True(t, canned.closed)
+}
+
+func TestResp3Conn_Do(t *testing.T) {
+	conn, canned := newCannedResp3Conn("-ERR first\r\n+OK\r\n:3\r\n:1\r\n:2\r\n")
+	assert.Nil(t, conn.Send("BF.ADD", "bf", []byte("a")))
+	assert.Nil(t, conn.Send("SET", "k", 1))
+	// the pending replies are read first, the first server error being returned with the last reply
+	reply, err := conn.Do("CMS.INCRBY", "cms", "a", int64(3))
+	assert.Equal(t, int64(3), reply)
+	assert.Equal(t, redis.Error("ERR first"), err)
+	assert.Equal(t, "*3\r\n$6\r\nBF.ADD\r\n$2\r\nbf\r\n$1\r\na\r\n"+
+		"*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$1\r\n1\r\n"+
+		"*4\r\n$10\r\nCMS.INCRBY\r\n$3\r\ncms\r\n$1\r\na\r\n$1\r\n3\r\n", canned.written.String())
+
+	assert.Nil(t, conn.Send("PING"))
+	assert.Nil(t, conn.Send("PING"))
+	replies, err := conn.Do("")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(1), int64(2)}, replies)
+}
+
+func TestResp3Conn_PushMessages(t *testing.T) {
+	conn, _ := newCannedResp3Conn(">2\r\n$10\r\ninvalidate\r\n*1\r\n$1\r\nk\r\n:1\r\n" +
+		">3\r\n$7\r\nmessage\r\n$2\r\nch\r\n$2\r\nhi\r\n+OK\r\n:2\r\n")
+	reply, err := conn.Do("BF.ADD", "bf", "a")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), reply)
+	assert.Nil(t, conn.Send("SET", "k", 1))
+	assert.Nil(t, conn.Flush())
+	reply, err = conn.Receive()
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", reply)
+	replies, err := conn.Do("")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{}, replies)
+	reply, err = conn.Do("PING")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), reply)
+}
+
+func TestResp3Conn_Timeouts(t *testing.T) {
+	local, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		// read the command and never reply
+		server.Read(make([]byte, 64))
+	}()
+	var conn redis.Conn = newResp3Conn(local)
+	timed, ok := conn.(redis.ConnWithTimeout)
+	assert.True(t, ok)
+	_, err := timed.DoWithTimeout(10*time.Millisecond, "PING")
+	assert.NotNil(t, err)
+	assert.True(t, err.(net.Error).Timeout())
+	// the connection is unusable after a timeout, as with redigo
+	assert.Equal(t, err, conn.Err())
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("cannot listen:", err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			defer conn.Close()
+			conn.Read(make([]byte, 64))
+			time.Sleep(time.Second)
+		}
+	}()
+	_, err = DialResp3("tcp", listener.Addr().String(), nil,
+		Resp3DialConnectTimeout(time.Second), Resp3DialReadTimeout(10*time.Millisecond))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "HELLO 3")
+}
+
+func TestResp3Conn_Context(t *testing.T) {
+	local, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		// reply to the first command only
+		server.Read(make([]byte, 64))
+		server.Write([]byte("+PONG\r\n"))
+		server.Read(make([]byte, 64))
+	}()
+	var conn redis.Conn = newResp3Conn(local)
+	withContext, ok := conn.(redis.ConnWithContext)
+	assert.True(t, ok)
+	ctx, cancel := context.WithCancel(context.Background())
+	reply, err := withContext.DoContext(ctx, "PING")
+	assert.Nil(t, err)
+	assert.Equal(t, "PONG", reply)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	_, err = withContext.DoContext(ctx, "PING")
+	assert.Equal(t, context.Canceled, err)
+	// the connection is unusable once a command is given up, as with redigo
+	assert.NotNil(t, conn.Err())
+
+	_, err = withContext.DoContext(ctx, "PING")
+	assert.Equal(t, context.Canceled, err)
+
+	local, server = net.Pipe()
+	defer server.Close()
+	go func() {
+		server.Read(make([]byte, 64))
+	}()
+	conn = newResp3Conn(local)
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = conn.(redis.ConnWithContext).DoContext(ctx, "PING")
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestDialResp3(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("cannot listen:", err)
+	}
+	defer listener.Close()
+	hello := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		server := newResp3Conn(conn)
+		// read the HELLO command as a RESP array of bulk strings
+		cmd, err := server.readReply()
+		if err != nil {
+			hello <- err.Error()
+			return
+		}
+		args, _ := redis.Strings(cmd, nil)
+		hello <- strings.Join(args, " ")
+		w := bufio.NewWriter(conn)
+		w.WriteString("%1\r\n+proto\r\n:3\r\n")
+		w.WriteString("%2\r\n+Compression\r\n:100\r\n+Merged weight\r\n,12\r\n")
+		w.Flush()
+	}()
+
+	password := "secret"
+	conn, err := DialResp3("tcp", listener.Addr().String(), &password)
+	assert.Nil(t, err)
+	defer conn.Close()
+	assert.Equal(t, "HELLO 3 AUTH default secret", <-hello)
+
+	info, err := ParseTDigestInfo(conn.Do("TDIGEST.INFO", "td"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(100), info.Compression())
+	assert.Equal(t, int64(12), info.MergedWeight())
+}
+
+// resp3Server answers with the RESP3 shapes of the replies
+func resp3Server(cmd string, args []interface{}) (interface{}, error) {
+	switch cmd {
+	case "BF.INFO":
+		return map[string]interface{}{"Capacity": int64(100), "Number of items inserted": int64(7)}, nil
+	case "CMS.INFO":
+		return map[string]interface{}{"width": int64(2000), "depth": int64(5), "count": int64(0)}, nil
+	case "TOPK.INFO":
+		return map[string]interface{}{"k": int64(10), "decay": 0.9}, nil
+	case "TOPK.LIST":
+		return []interface{}{[]byte("a"), int64(3), []byte("b"), int64(1)}, nil
+	case "TDIGEST.MIN":
+		return 1.5, nil
+	case "TDIGEST.QUANTILE":
+		return []interface{}{2.5, math.Inf(1)}, nil
+	}
+	return "OK", nil
+}
+
+func TestClient_Resp3Replies(t *testing.T) {
+	client := &Client{Pool: &redistest.Pool{Reply: resp3Server}}
+
+	info, err := client.Info("bf")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int64{"Capacity": 100, "Number of items inserted": 7}, info)
+
+	cmsInfo, err := client.CmsInfo("cms")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2000), cmsInfo["width"])
+
+	topkInfo, err := client.TopkInfo("topk")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"k": "10", "decay": "0.9"}, topkInfo)
+
+	list, err := client.TopkListWithCount("topk")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int64{"a": 3, "b": 1}, list)
+
+	min, err := client.TdMin("td")
+	assert.Nil(t, err)
+	assert.Equal(t, 1.5, min)
+
+	quantiles, err := client.TdQuantiles("td", 0.5, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []float64{2.5, math.Inf(1)}, quantiles)
+}
+
+func TestParseInfoReply_Malformed(t *testing.T) {
+	_, err := ParseInfoReply([]interface{}{int64(1), int64(2)}, nil)
+	assert.NotNil(t, err)
+	_, err = ParseInfoReply([]interface{}{"width", 2.5}, nil)
+	assert.NotNil(t, err)
+	_, err = ParseTDigestInfo(map[string]interface{}{"Compression": []interface{}{}}, nil)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,138 @@
+package redis_bloom_go
+
+import (
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// RotatingBloomOptions configures a RotatingBloomFilter
+type RotatingBloomOptions struct {
+	// Interval is the time span covered by each underlying filter
+	Interval time.Duration
+	// Buckets is the number of filters that make up the window, which spans Interval*Buckets
+	Buckets int
+	// Capacity is the initial capacity of each filter; the server default is used when 0
+	Capacity int64
+	// ErrorRate is the desired false positive rate of each filter; the server default is used when 0
+	ErrorRate float64
+}
+
+// RotatingBloomFilter answers "seen in the last Interval*Buckets" with one Bloom filter per interval, stored
+// under prefix:<interval number>. Items are added to the filter of the current interval, and checked against
+// all the filters of the window. Each filter is given a TTL when created so it expires as it leaves the window.
+// With n live filters the false positive rate of Exists is up to n times the one of a single filter.
+type RotatingBloomFilter struct {
+	client *Client
+	opts   RotatingBloomOptions
+	window timeWindow
+}
+
+// NewRotatingBloomFilter creates a RotatingBloomFilter storing its filters under prefix
+func NewRotatingBloomFilter(client *Client, prefix string, opts RotatingBloomOptions) (*RotatingBloomFilter, error) {
+	window, err := newTimeWindow(prefix, opts.Interval, opts.Buckets)
+	if err != nil {
+		return nil, err
+	}
+	return &RotatingBloomFilter{client: client, opts: opts, window: window}, nil
+}
+
+// Keys returns the keys of the filters currently in the window, most recent first
+func (f *RotatingBloomFilter) Keys() []string {
+	return f.window.keys(f.window.live())
+}
+
+// Add adds an item to the filter of the current interval, reporting whether it was newly added to it
+func (f *RotatingBloomFilter) Add(item string) (bool, error) {
+	added, err := f.AddMulti([]string{item})
+	if err != nil {
+		return false, err
+	}
+	return added[0] == 1, nil
+}
+
+// AddMulti adds items to the filter of the current interval, creating it if needed.
+// For each item the result is 1 when it was newly added to the current filter and 0 otherwise.
+func (f *RotatingBloomFilter) AddMulti(items []string) ([]int64, error) {
+	bucket := f.window.current()
+	conn := f.client.getConn()
+	defer conn.Close()
+	replies, err := doPipeline(conn, f.addCmds(bucket, items))
+	if err != nil {
+		return nil, err
+	}
+	if _, err = redis.Int64(replies[1], nil); err != nil {
+		return nil, err
+	}
+	return redis.Int64s(replies[0], nil)
+}
+
+// addCmds returns the commands adding items to bucket and setting its TTL
+func (f *RotatingBloomFilter) addCmds(bucket int64, items []string) []pipelineCmd {
+	key := f.window.key(bucket)
+	args := getBfInsertArgs(key, f.opts.Capacity, f.opts.ErrorRate, 0, false, false).AddFlat(items)
+	return []pipelineCmd{
+		{"BF.INSERT", args},
+		{"PEXPIREAT", redis.Args{key, f.window.expireAt(bucket)}},
+	}
+}
+
+// Exists determines whether an item may have been added during the window, with one BF.EXISTS per live
+// filter pipelined over a single connection.
+func (f *RotatingBloomFilter) Exists(item string) (bool, error) {
+	keys := f.Keys()
+	cmds := make([]pipelineCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipelineCmd{"BF.EXISTS", redis.Args{key, item}}
+	}
+	conn := f.client.getConn()
+	defer conn.Close()
+	replies, err := doPipeline(conn, cmds)
+	if err != nil {
+		return false, err
+	}
+	exists := false
+	for _, reply := range replies {
+		found, err := redis.Bool(reply, nil)
+		if err != nil {
+			return false, err
+		}
+		exists = exists || found
+	}
+	return exists, nil
+}
+
+// ExistsMulti determines whether items may have been added during the window, with one BF.MEXISTS per live
+// filter pipelined over a single connection. For each item the result is 1 when it may exist and 0 otherwise.
+func (f *RotatingBloomFilter) ExistsMulti(items []string) ([]int64, error) {
+	keys := f.Keys()
+	cmds := make([]pipelineCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipelineCmd{"BF.MEXISTS", redis.Args{key}.AddFlat(items)}
+	}
+	conn := f.client.getConn()
+	defer conn.Close()
+	replies, err := doPipeline(conn, cmds)
+	if err != nil {
+		return nil, err
+	}
+	return mergeExists(len(items), replies)
+}
+
+// mergeExists combines BF.MEXISTS replies from several filters: an item exists when it exists in any of them
+func mergeExists(n int, replies []interface{}) ([]int64, error) {
+	result := make([]int64, n)
+	for _, reply := range replies {
+		exists, err := redis.Int64s(reply, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(exists) != n {
+			return nil, replyDecoder{"BF.MEXISTS"}.errorf("expects %d values, got %d", n, len(exists))
+		}
+		for i := range result {
+			result[i] |= exists[i]
+		}
+	}
+	return result, nil
+}
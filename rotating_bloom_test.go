@@ -0,0 +1,102 @@
+package redis_bloom_go
+
+import (
+	"testing"
+	"time"
+
+	"github.com/RedisBloom/redisbloom-go/internal/redistest"
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock returns a clock function that reads *now
+func fakeClock(now *time.Time) func() time.Time {
+	return func() time.Time { return *now }
+}
+
+func TestRotatingBloomFilter_Keys(t *testing.T) {
+	f, err := NewRotatingBloomFilter(&Client{}, "seen", RotatingBloomOptions{Interval: time.Hour, Buckets: 3})
+	assert.Nil(t, err)
+	now := time.Unix(10*3600+60, 0)
+	f.window.now = fakeClock(&now)
+	assert.Equal(t, []string{"seen:10", "seen:9", "seen:8"}, f.Keys())
+	assert.Equal(t, int64(13*3600*1000), f.window.expireAt(10))
+
+	_, err = NewRotatingBloomFilter(&Client{}, "seen", RotatingBloomOptions{Interval: time.Hour})
+	assert.NotNil(t, err)
+	_, err = NewRotatingBloomFilter(&Client{}, "seen", RotatingBloomOptions{Buckets: 1})
+	assert.NotNil(t, err)
+}
+
+func TestRotatingBloomFilter_WindowFake(t *testing.T) {
+	now := time.Unix(10*3600, 0)
+	server := newFilterServer(&now)
+	f, err := NewRotatingBloomFilter(&Client{Pool: &redistest.Pool{Reply: server.reply}}, "seen", RotatingBloomOptions{Interval: time.Hour, Buckets: 2})
+	assert.Nil(t, err)
+	f.window.now = fakeClock(&now)
+	added, err := f.Add("a")
+	assert.Nil(t, err)
+	assert.True(t, added)
+	added, err = f.Add("a")
+	assert.Nil(t, err)
+	assert.False(t, added)
+
+	// one interval later "a" is still in the window, but additions go to a fresh filter
+	now = now.Add(time.Hour)
+	exists, err := f.Exists("a")
+	assert.Nil(t, err)
+	assert.True(t, exists)
+	ret, err := f.AddMulti([]string{"a", "b"})
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1, 1}, ret)
+
+	// "a" stays as long as it is added again, "c" was never added
+	now = now.Add(time.Hour)
+	ret, err = f.ExistsMulti([]string{"a", "b", "c"})
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1, 1, 0}, ret)
+	now = now.Add(2 * time.Hour)
+	exists, err = f.Exists("a")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+}
+
+func TestRotatingBloomFilter(t *testing.T) {
+	client.FlushAll()
+	f, err := NewRotatingBloomFilter(client, "test_rotating", RotatingBloomOptions{
+		Interval:  time.Hour,
+		Buckets:   2,
+		Capacity:  1000,
+		ErrorRate: 0.001,
+	})
+	assert.Nil(t, err)
+	now := time.Now()
+	f.window.now = fakeClock(&now)
+
+	added, err := f.Add("a")
+	assert.Nil(t, err)
+	assert.True(t, added)
+	added, err = f.Add("a")
+	assert.Nil(t, err)
+	assert.False(t, added)
+	conn := client.Pool.Get()
+	defer conn.Close()
+	ttl, err := redis.Int64(conn.Do("PTTL", f.Keys()[0]))
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0)
+
+	// one interval later "a" is still in the window
+	now = now.Add(time.Hour)
+	exists, err := f.Exists("a")
+	assert.Nil(t, err)
+	assert.True(t, exists)
+	ret, err := f.AddMulti([]string{"a", "b"})
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1, 1}, ret)
+
+	// two intervals later only the items added during the second interval remain
+	now = now.Add(time.Hour)
+	ret, err = f.ExistsMulti([]string{"a", "b", "c"})
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1, 1, 0}, ret)
+}
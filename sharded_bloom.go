@@ -0,0 +1,222 @@
+package redis_bloom_go
+
+import (
+	"errors"
+	"hash/fnv"
+	"strconv"
+	"sync"
+)
+
+// ShardedBloomOptions configures a ShardedBloomFilter
+type ShardedBloomOptions struct {
+	// Shards is the number of underlying Bloom filters
+	Shards int
+	// Capacity is the total number of entries you intend to add, split evenly across the shards by Reserve
+	Capacity uint64
+	// ErrorRate is the desired false positive rate of every shard, and so of the sharded filter
+	ErrorRate float64
+	// SpreadSlots names the shards prefix:<shard> so that they hash to different cluster slots, and sends the
+	// commands of every shard to the connection the pool returns for its key. It requires the Pool of the client
+	// to be a KeyedPool. By default the shards are named {prefix}:<shard> and share the slot of the prefix.
+	SpreadSlots bool
+}
+
+// ShardedBloomFilter is a Bloom filter split over several keys, for sets too large for a single key.
+// Each item is hashed with FNV-1a to one of the shards, so it is always added to and checked against the same
+// filter. Multi-item calls group the items per shard, run one command per shard in parallel and return the
+// results in input order.
+type ShardedBloomFilter struct {
+	opts ShardedBloomOptions
+	keys []string
+	// clients holds the client of every shard, routed to the node serving its key with SpreadSlots
+	clients []*Client
+}
+
+// NewShardedBloomFilter creates a ShardedBloomFilter storing its shards under prefix
+func NewShardedBloomFilter(client *Client, prefix string, opts ShardedBloomOptions) (*ShardedBloomFilter, error) {
+	if opts.Shards < 1 {
+		return nil, errors.New("a minimum of one shard is required")
+	}
+	var keyed KeyedPool
+	if opts.SpreadSlots {
+		var ok bool
+		if keyed, ok = client.Pool.(KeyedPool); !ok {
+			return nil, errors.New("spreading the shards over cluster slots requires a KeyedPool")
+		}
+		// the clients of the shards share the capabilities probed by client
+		client.capabilitiesProbe()
+	}
+	keys := make([]string, opts.Shards)
+	clients := make([]*Client, opts.Shards)
+	for i := range keys {
+		if opts.SpreadSlots {
+			keys[i] = prefix + ":" + strconv.Itoa(i)
+			routed := *client
+			routed.Pool = keyPool{pool: keyed, key: keys[i]}
+			clients[i] = &routed
+		} else {
+			keys[i] = "{" + prefix + "}:" + strconv.Itoa(i)
+			clients[i] = client
+		}
+	}
+	return &ShardedBloomFilter{opts: opts, keys: keys, clients: clients}, nil
+}
+
+// Keys returns the keys of the shards
+func (f *ShardedBloomFilter) Keys() []string {
+	return f.keys
+}
+
+// shard returns the index of the shard item belongs to
+func (f *ShardedBloomFilter) shard(item string) int {
+	h := fnv.New64a()
+	h.Write([]byte(item))
+	return int(h.Sum64() % uint64(len(f.keys)))
+}
+
+// forEachShard runs fn concurrently for the given shards and returns the first error
+func (f *ShardedBloomFilter) forEachShard(shards []int, fn func(shard int) error) error {
+	errs := make([]error, len(shards))
+	var wg sync.WaitGroup
+	for i, shard := range shards {
+		wg.Add(1)
+		go func(i, shard int) {
+			defer wg.Done()
+			errs[i] = fn(shard)
+		}(i, shard)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// allShards returns the indexes of all the shards
+func (f *ShardedBloomFilter) allShards() []int {
+	shards := make([]int, len(f.keys))
+	for i := range shards {
+		shards[i] = i
+	}
+	return shards
+}
+
+// Reserve creates all the shards, each with an equal part of Capacity and the configured ErrorRate
+func (f *ShardedBloomFilter) Reserve() error {
+	capacity := (f.opts.Capacity + uint64(len(f.keys)) - 1) / uint64(len(f.keys))
+	return f.forEachShard(f.allShards(), func(shard int) error {
+		return f.clients[shard].Reserve(f.keys[shard], f.opts.ErrorRate, capacity)
+	})
+}
+
+// Add adds an item to its shard, reporting whether it was newly added
+func (f *ShardedBloomFilter) Add(item string) (bool, error) {
+	shard := f.shard(item)
+	return f.clients[shard].Add(f.keys[shard], item)
+}
+
+// Exists determines whether an item may exist in its shard or not
+func (f *ShardedBloomFilter) Exists(item string) (bool, error) {
+	shard := f.shard(item)
+	return f.clients[shard].Exists(f.keys[shard], item)
+}
+
+// AddMulti adds items to their shards with one BF.MADD per shard, run in parallel.
+// For each item the result is 1 when it was newly added and 0 otherwise.
+func (f *ShardedBloomFilter) AddMulti(items []string) ([]int64, error) {
+	return f.doMulti(items, (*Client).BfAddMulti)
+}
+
+// ExistsMulti determines whether items may exist with one BF.MEXISTS per shard, run in parallel.
+// For each item the result is 1 when it may exist and 0 otherwise.
+func (f *ShardedBloomFilter) ExistsMulti(items []string) ([]int64, error) {
+	return f.doMulti(items, (*Client).BfExistsMulti)
+}
+
+// doMulti groups items per shard, calls cmd on every shard holding some of them and reassembles the results
+func (f *ShardedBloomFilter) doMulti(items []string, cmd func(client *Client, key string, items []string) ([]int64, error)) ([]int64, error) {
+	shardItems := make([][]string, len(f.keys))
+	shardIndexes := make([][]int, len(f.keys))
+	var shards []int
+	for i, item := range items {
+		shard := f.shard(item)
+		if len(shardItems[shard]) == 0 {
+			shards = append(shards, shard)
+		}
+		shardItems[shard] = append(shardItems[shard], item)
+		shardIndexes[shard] = append(shardIndexes[shard], i)
+	}
+	result := make([]int64, len(items))
+	err := f.forEachShard(shards, func(shard int) error {
+		values, err := cmd(f.clients[shard], f.keys[shard], shardItems[shard])
+		if err != nil {
+			return err
+		}
+		if len(values) != len(shardIndexes[shard]) {
+			return errors.New("unexpected number of values in result")
+		}
+		for i, value := range values {
+			result[shardIndexes[shard][i]] = value
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Info returns the information of all the shards combined. Capacity, Size, Number of filters and Number of
+// items inserted are summed, other fields are taken from the first shard.
+func (f *ShardedBloomFilter) Info() (map[string]int64, error) {
+	infos := make([]map[string]int64, len(f.keys))
+	err := f.forEachShard(f.allShards(), func(shard int) (err error) {
+		infos[shard], err = f.clients[shard].Info(f.keys[shard])
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return mergeShardedBloomInfo(infos), nil
+}
+
+// summedBloomInfo lists the BF.INFO fields that add up across shards
+var summedBloomInfo = map[string]bool{
+	"Capacity":                 true,
+	"Size":                     true,
+	"Number of filters":        true,
+	"Number of items inserted": true,
+}
+
+func mergeShardedBloomInfo(infos []map[string]int64) map[string]int64 {
+	merged := map[string]int64{}
+	for i, info := range infos {
+		for field, value := range info {
+			if summedBloomInfo[field] {
+				merged[field] += value
+			} else if i == 0 {
+				merged[field] = value
+			}
+		}
+	}
+	return merged
+}
+
+// BfCard returns the number of items added to all the shards
+func (f *ShardedBloomFilter) BfCard() (int64, error) {
+	cards := make([]int64, len(f.keys))
+	err := f.forEachShard(f.allShards(), func(shard int) (err error) {
+		cards[shard], err = f.clients[shard].BfCard(f.keys[shard])
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, card := range cards {
+		total += card
+	}
+	return total, nil
+}
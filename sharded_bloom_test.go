@@ -0,0 +1,128 @@
+package redis_bloom_go
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/RedisBloom/redisbloom-go/internal/redistest"
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+// nodePool is a KeyedPool with one node per key, every node keeping its filters in a filterServer
+type nodePool struct {
+	nodes map[string]*redistest.Pool
+}
+
+func newNodePool(keys []string) *nodePool {
+	p := &nodePool{nodes: map[string]*redistest.Pool{}}
+	now := time.Now()
+	for _, key := range keys {
+		p.nodes[key] = &redistest.Pool{Reply: newFilterServer(&now).reply}
+	}
+	return p
+}
+
+func (p *nodePool) Get() redis.Conn {
+	panic("every command of a spread shard goes to the node serving its key")
+}
+
+func (p *nodePool) GetForKey(key string) redis.Conn {
+	return p.nodes[key].Get()
+}
+
+func (p *nodePool) Close() error {
+	return nil
+}
+
+func TestShardedBloomFilter_Keys(t *testing.T) {
+	f, err := NewShardedBloomFilter(&Client{}, "users", ShardedBloomOptions{Shards: 3})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"{users}:0", "{users}:1", "{users}:2"}, f.Keys())
+	f, err = NewShardedBloomFilter(&Client{Pool: newNodePool(nil)}, "users", ShardedBloomOptions{Shards: 2, SpreadSlots: true})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"users:0", "users:1"}, f.Keys())
+	_, err = NewShardedBloomFilter(&Client{}, "users", ShardedBloomOptions{})
+	assert.NotNil(t, err)
+	// without a KeyedPool all the shards would go to the same node
+	_, err = NewShardedBloomFilter(&Client{Pool: &redistest.Pool{}}, "users", ShardedBloomOptions{Shards: 2, SpreadSlots: true})
+	assert.NotNil(t, err)
+}
+
+func TestShardedBloomFilter_SpreadSlots(t *testing.T) {
+	pool := newNodePool([]string{"s:0", "s:1", "s:2", "s:3"})
+	f, err := NewShardedBloomFilter(&Client{Pool: pool}, "s", ShardedBloomOptions{Shards: 4, SpreadSlots: true})
+	assert.Nil(t, err)
+	items := make([]string, 100)
+	for i := range items {
+		items[i] = strconv.Itoa(i)
+	}
+	added, err := f.AddMulti(items[:50])
+	assert.Nil(t, err)
+	for _, a := range added {
+		assert.Equal(t, int64(1), a)
+	}
+	// the results follow the input order although every shard answers for its own items
+	exists, err := f.ExistsMulti(items)
+	assert.Nil(t, err)
+	for i := range items {
+		assert.Equal(t, boolInt(i < 50), exists[i])
+	}
+	ok, err := f.Exists("0")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	// every node only received the items of the shard it serves
+	for key, node := range pool.nodes {
+		assert.True(t, len(node.Commands) > 0)
+		for _, cmd := range node.Commands {
+			for _, item := range cmd[2:] {
+				assert.Equal(t, key, f.keys[f.shard(item.(string))])
+			}
+		}
+	}
+}
+
+func TestMergeShardedBloomInfo(t *testing.T) {
+	info := mergeShardedBloomInfo([]map[string]int64{
+		{"Capacity": 100, "Size": 200, "Number of filters": 1, "Number of items inserted": 10, "Expansion rate": 2},
+		{"Capacity": 100, "Size": 200, "Number of filters": 2, "Number of items inserted": 20, "Expansion rate": 2},
+	})
+	assert.Equal(t, map[string]int64{
+		"Capacity": 200, "Size": 400, "Number of filters": 3, "Number of items inserted": 30, "Expansion rate": 2,
+	}, info)
+}
+
+func TestShardedBloomFilter(t *testing.T) {
+	client.FlushAll()
+	f, err := NewShardedBloomFilter(client, "test_sharded", ShardedBloomOptions{
+		Shards:    4,
+		Capacity:  4000,
+		ErrorRate: 0.001,
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, f.Reserve())
+
+	added, err := f.Add("a")
+	assert.Nil(t, err)
+	assert.True(t, added)
+	exists, err := f.Exists("a")
+	assert.Nil(t, err)
+	assert.True(t, exists)
+
+	ret, err := f.AddMulti([]string{"a", "b", "c", "d", "e"})
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{0, 1, 1, 1, 1}, ret)
+	ret, err = f.ExistsMulti([]string{"e", "x", "a"})
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1, 0, 1}, ret)
+
+	card, err := f.BfCard()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), card)
+	info, err := f.Info()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4000), info["Capacity"])
+	assert.Equal(t, int64(5), info["Number of items inserted"])
+}
@@ -0,0 +1,252 @@
+package redis_bloom_go
+
+import (
+	"errors"
+	"math"
+)
+
+// The sizing helpers below mirror the allocation math of the RedisBloom module, so the memory
+// of a structure can be estimated before it is created. Sizes cover the filter and sketch bodies
+// only; the server adds a small, fixed overhead per key and per sub-filter.
+
+// bloomErrorTighteningRatio is the factor applied to the error rate of every new sub-filter of a scaling Bloom filter
+const bloomErrorTighteningRatio = 0.5
+
+// BloomSubFilterSizing is a struct that represents the estimated dimensions of one sub-filter of a Bloom filter
+type BloomSubFilterSizing struct {
+	// Capacity is the number of items the sub-filter holds before the next one is added
+	Capacity uint64
+	// ErrorRate is the false positive rate of the sub-filter
+	ErrorRate float64
+	// BitsPerItem is the number of bits used per item
+	BitsPerItem float64
+	// Hashes is the number of hash functions
+	Hashes int64
+	// Bytes is the memory of the bit array
+	Bytes uint64
+}
+
+// BloomSizing is a struct that represents the estimated dimensions of a scaling Bloom filter
+type BloomSizing struct {
+	// SubFilters holds the initial sub-filter followed by one entry per expansion
+	SubFilters []BloomSubFilterSizing
+	// TotalCapacity is the number of items held by all sub-filters
+	TotalCapacity uint64
+	// TotalErrorRate is an upper bound of the false positive rate once all sub-filters are in use
+	TotalErrorRate float64
+	// TotalBytes is the memory of all sub-filters
+	TotalBytes uint64
+}
+
+// BloomBitsPerItem returns the number of bits per item a Bloom filter needs for the given error rate
+func BloomBitsPerItem(errorRate float64) float64 {
+	return -math.Log(errorRate) / (math.Ln2 * math.Ln2)
+}
+
+// BloomHashes returns the number of hash functions a Bloom filter uses for the given error rate
+func BloomHashes(errorRate float64) int64 {
+	return int64(math.Ceil(math.Ln2 * BloomBitsPerItem(errorRate)))
+}
+
+// BloomFilterSizing estimates the dimensions of a Bloom filter created with BF.RESERVE or BF.INSERT, and of the
+// sub-filters it adds when it grows. expansion is the growth factor of each new sub-filter (2 by default on the
+// server), and expansions the number of times the filter is expected to grow; use 0 for a non-scaling filter.
+func BloomFilterSizing(capacity uint64, errorRate float64, expansion uint64, expansions int) (BloomSizing, error) {
+	if err := checkBloomSizingArgs(capacity, expansion, expansions); err != nil {
+		return BloomSizing{}, err
+	}
+	if errorRate <= 0 || errorRate >= 1 {
+		return BloomSizing{}, errors.New("error rate must be between 0 and 1")
+	}
+	sizing := BloomSizing{SubFilters: make([]BloomSubFilterSizing, 0, expansions+1)}
+	subCapacity, subErrorRate := float64(capacity), errorRate
+	for i := 0; i <= expansions; i++ {
+		bpe := BloomBitsPerItem(subErrorRate)
+		sub := BloomSubFilterSizing{
+			Capacity:    uint64(subCapacity),
+			ErrorRate:   subErrorRate,
+			BitsPerItem: bpe,
+			Hashes:      BloomHashes(subErrorRate),
+			Bytes:       uint64(math.Ceil(subCapacity * bpe / 8)),
+		}
+		sizing.SubFilters = append(sizing.SubFilters, sub)
+		sizing.TotalCapacity += sub.Capacity
+		sizing.TotalErrorRate += sub.ErrorRate
+		sizing.TotalBytes += sub.Bytes
+		subCapacity *= float64(expansion)
+		subErrorRate *= bloomErrorTighteningRatio
+	}
+	return sizing, nil
+}
+
+// BloomErrorRateForMemory returns the lowest error rate for which a Bloom filter of the given capacity, including
+// its expected expansions, fits in memoryBytes. See BloomFilterSizing for the meaning of the arguments.
+func BloomErrorRateForMemory(capacity uint64, expansion uint64, expansions int, memoryBytes uint64) (float64, error) {
+	if err := checkBloomSizingArgs(capacity, expansion, expansions); err != nil {
+		return 0, err
+	}
+	fits := func(errorRate float64) bool {
+		sizing, _ := BloomFilterSizing(capacity, errorRate, expansion, expansions)
+		return sizing.TotalBytes <= memoryBytes
+	}
+	// the memory shrinks as the error rate grows, so bisect on the logarithm of the error rate
+	low, high := math.Log(1e-15), math.Log(0.999)
+	if !fits(math.Exp(high)) {
+		return 0, errors.New("memory budget too small for the requested capacity")
+	}
+	if fits(math.Exp(low)) {
+		return math.Exp(low), nil
+	}
+	for i := 0; i < 100; i++ {
+		mid := (low + high) / 2
+		if fits(math.Exp(mid)) {
+			high = mid
+		} else {
+			low = mid
+		}
+	}
+	return math.Exp(high), nil
+}
+
+func checkBloomSizingArgs(capacity uint64, expansion uint64, expansions int) error {
+	if capacity == 0 {
+		return errors.New("capacity must be positive")
+	}
+	if expansion < 1 {
+		return errors.New("expansion must be at least 1")
+	}
+	if expansions < 0 {
+		return errors.New("expansions must not be negative")
+	}
+	return nil
+}
+
+// cmsCounterBytes is the size of a single Count-Min Sketch counter
+const cmsCounterBytes = 4
+
+// CmsSizing is a struct that represents the dimensions of a Count-Min Sketch
+type CmsSizing struct {
+	Width int64
+	Depth int64
+	// ErrorRate is the over-estimation of a count, as a fraction of the total count of the sketch
+	ErrorRate float64
+	// Probability is the probability of a count exceeding the error rate
+	Probability float64
+	// Bytes is the memory of the counters
+	Bytes uint64
+}
+
+// CmsSizingByProb returns the dimensions CMS.INITBYPROB allocates for the given error rate and probability
+func CmsSizingByProb(errorRate float64, probability float64) (CmsSizing, error) {
+	if errorRate <= 0 || errorRate >= 1 {
+		return CmsSizing{}, errors.New("error rate must be between 0 and 1")
+	}
+	if probability <= 0 || probability >= 1 {
+		return CmsSizing{}, errors.New("probability must be between 0 and 1")
+	}
+	width := int64(math.Ceil(2 / errorRate))
+	depth := int64(math.Ceil(math.Log10(probability) / math.Log10(0.5)))
+	return CmsSizingByDim(width, depth)
+}
+
+// CmsSizingByDim returns the guarantees and memory of a sketch created with CMS.INITBYDIM
+func CmsSizingByDim(width int64, depth int64) (CmsSizing, error) {
+	if width <= 0 || depth <= 0 {
+		return CmsSizing{}, errors.New("width and depth must be positive")
+	}
+	return CmsSizing{
+		Width:       width,
+		Depth:       depth,
+		ErrorRate:   2 / float64(width),
+		Probability: math.Pow(0.5, float64(depth)),
+		Bytes:       uint64(width) * uint64(depth) * cmsCounterBytes,
+	}, nil
+}
+
+// cuckooFingerprintValues is the number of distinct values of the 8-bit fingerprints of a Cuckoo filter
+const cuckooFingerprintValues = 255
+
+// CuckooSubFilterSizing is a struct that represents the dimensions of one sub-filter of a Cuckoo filter
+type CuckooSubFilterSizing struct {
+	NumBuckets uint64
+	// Capacity is the number of fingerprint slots, numBuckets*bucketSize
+	Capacity uint64
+	// Bytes is the memory of the buckets
+	Bytes uint64
+}
+
+// CuckooSizing is a struct that represents the dimensions of a Cuckoo filter
+type CuckooSizing struct {
+	BucketSize int64
+	// ErrorRate is the false positive rate of a single sub-filter, 2*bucketSize/255
+	ErrorRate float64
+	// SubFilters holds the initial sub-filter followed by one entry per expansion
+	SubFilters []CuckooSubFilterSizing
+	// TotalErrorRate is an upper bound of the false positive rate once all sub-filters are in use
+	TotalErrorRate float64
+	TotalCapacity  uint64
+	TotalBytes     uint64
+}
+
+// CuckooFilterSizing estimates the dimensions of a Cuckoo filter created with CF.RESERVE, and of the sub-filters it
+// adds when it grows. bucketSize defaults to 2 and expansion to 1 when 0, as on the server, and expansions is the
+// number of times the filter is expected to grow.
+func CuckooFilterSizing(capacity uint64, bucketSize int64, expansion uint64, expansions int) (CuckooSizing, error) {
+	if bucketSize == 0 {
+		bucketSize = 2
+	}
+	if expansion == 0 {
+		expansion = 1
+	}
+	if capacity == 0 {
+		return CuckooSizing{}, errors.New("capacity must be positive")
+	}
+	if bucketSize < 1 || bucketSize > cuckooFingerprintValues {
+		return CuckooSizing{}, errors.New("bucket size must be between 1 and 255")
+	}
+	if expansions < 0 {
+		return CuckooSizing{}, errors.New("expansions must not be negative")
+	}
+	// the server rounds both the number of buckets and the expansion up to a power of two
+	numBuckets := nextPowerOfTwo(capacity / uint64(bucketSize))
+	expansion = nextPowerOfTwo(expansion)
+	sizing := CuckooSizing{
+		BucketSize: bucketSize,
+		ErrorRate:  2 * float64(bucketSize) / cuckooFingerprintValues,
+		SubFilters: make([]CuckooSubFilterSizing, 0, expansions+1),
+	}
+	for i := 0; i <= expansions; i++ {
+		sub := CuckooSubFilterSizing{
+			NumBuckets: numBuckets,
+			Capacity:   numBuckets * uint64(bucketSize),
+			Bytes:      numBuckets * uint64(bucketSize),
+		}
+		sizing.SubFilters = append(sizing.SubFilters, sub)
+		sizing.TotalCapacity += sub.Capacity
+		sizing.TotalBytes += sub.Bytes
+		sizing.TotalErrorRate += sizing.ErrorRate
+		numBuckets *= expansion
+	}
+	return sizing, nil
+}
+
+// CuckooBucketSizeForErrorRate returns the largest bucket size, and so the best fill rate, whose false positive
+// rate does not exceed errorRate
+func CuckooBucketSizeForErrorRate(errorRate float64) (int64, error) {
+	bucketSize := int64(math.Floor(errorRate * cuckooFingerprintValues / 2))
+	if bucketSize < 1 {
+		return 0, errors.New("error rate too low for a cuckoo filter")
+	}
+	if bucketSize > cuckooFingerprintValues {
+		bucketSize = cuckooFingerprintValues
+	}
+	return bucketSize, nil
+}
+
+func nextPowerOfTwo(n uint64) uint64 {
+	p := uint64(1)
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
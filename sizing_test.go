@@ -0,0 +1,97 @@
+package redis_bloom_go
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBloomFilterSizing(t *testing.T) {
+	sizing, err := BloomFilterSizing(1000, 0.01, 2, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(sizing.SubFilters))
+	first := sizing.SubFilters[0]
+	assert.Equal(t, uint64(1000), first.Capacity)
+	assert.InDelta(t, 9.585, first.BitsPerItem, 0.001)
+	assert.Equal(t, int64(7), first.Hashes)
+	assert.Equal(t, uint64(1199), first.Bytes)
+	assert.Equal(t, uint64(2000), sizing.SubFilters[1].Capacity)
+	assert.InDelta(t, 0.005, sizing.SubFilters[1].ErrorRate, 1e-12)
+	assert.Equal(t, uint64(4000), sizing.SubFilters[2].Capacity)
+	assert.Equal(t, uint64(7000), sizing.TotalCapacity)
+	assert.InDelta(t, 0.0175, sizing.TotalErrorRate, 1e-12)
+	assert.Equal(t, first.Bytes+sizing.SubFilters[1].Bytes+sizing.SubFilters[2].Bytes, sizing.TotalBytes)
+
+	nonScaling, err := BloomFilterSizing(1000, 0.01, 1, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(nonScaling.SubFilters))
+	assert.Equal(t, first.Bytes, nonScaling.TotalBytes)
+
+	_, err = BloomFilterSizing(0, 0.01, 2, 0)
+	assert.NotNil(t, err)
+	_, err = BloomFilterSizing(1000, 1.5, 2, 0)
+	assert.NotNil(t, err)
+	_, err = BloomFilterSizing(1000, 0.01, 0, 0)
+	assert.NotNil(t, err)
+}
+
+func TestBloomErrorRateForMemory(t *testing.T) {
+	errorRate, err := BloomErrorRateForMemory(1000, 2, 2, 10000)
+	assert.Nil(t, err)
+	sizing, err := BloomFilterSizing(1000, errorRate, 2, 2)
+	assert.Nil(t, err)
+	assert.True(t, sizing.TotalBytes <= 10000)
+	tighter, err := BloomFilterSizing(1000, errorRate*0.99, 2, 2)
+	assert.Nil(t, err)
+	assert.True(t, tighter.TotalBytes > 10000)
+
+	_, err = BloomErrorRateForMemory(1000000, 2, 0, 1)
+	assert.NotNil(t, err)
+}
+
+func TestCmsSizing(t *testing.T) {
+	sizing, err := CmsSizingByProb(0.001, 0.01)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2000), sizing.Width)
+	assert.Equal(t, int64(7), sizing.Depth)
+	assert.Equal(t, uint64(56000), sizing.Bytes)
+	assert.InDelta(t, 0.001, sizing.ErrorRate, 1e-12)
+	assert.True(t, sizing.Probability <= 0.01)
+
+	sizing, err = CmsSizingByDim(1000, 5)
+	assert.Nil(t, err)
+	assert.InDelta(t, 0.002, sizing.ErrorRate, 1e-12)
+	assert.InDelta(t, 0.03125, sizing.Probability, 1e-12)
+	assert.Equal(t, uint64(20000), sizing.Bytes)
+
+	_, err = CmsSizingByProb(0, 0.01)
+	assert.NotNil(t, err)
+	_, err = CmsSizingByDim(0, 5)
+	assert.NotNil(t, err)
+}
+
+func TestCuckooFilterSizing(t *testing.T) {
+	sizing, err := CuckooFilterSizing(1000, 0, 0, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), sizing.BucketSize)
+	assert.Equal(t, 2, len(sizing.SubFilters))
+	assert.Equal(t, uint64(512), sizing.SubFilters[0].NumBuckets)
+	assert.Equal(t, uint64(1024), sizing.SubFilters[0].Bytes)
+	assert.Equal(t, uint64(512), sizing.SubFilters[1].NumBuckets)
+	assert.Equal(t, uint64(2048), sizing.TotalBytes)
+	assert.InDelta(t, 4.0/255, sizing.ErrorRate, 1e-12)
+
+	sizing, err = CuckooFilterSizing(1000, 4, 3, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(256), sizing.SubFilters[0].NumBuckets)
+	assert.Equal(t, uint64(1024), sizing.SubFilters[1].NumBuckets)
+
+	_, err = CuckooFilterSizing(0, 2, 1, 0)
+	assert.NotNil(t, err)
+
+	bucketSize, err := CuckooBucketSizeForErrorRate(0.03)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), bucketSize)
+	_, err = CuckooBucketSizeForErrorRate(0.001)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,117 @@
+package redis_bloom_go
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// timeWindow splits time into fixed intervals and tracks the last buckets of them, which make up the window.
+// Bucket n covers [n*interval, (n+1)*interval) since the Unix epoch and is stored under prefix:n.
+type timeWindow struct {
+	prefix   string
+	interval time.Duration
+	buckets  int
+	now      func() time.Time
+}
+
+func newTimeWindow(prefix string, interval time.Duration, buckets int) (timeWindow, error) {
+	if interval <= 0 {
+		return timeWindow{}, errors.New("interval must be positive")
+	}
+	if buckets < 1 {
+		return timeWindow{}, errors.New("a minimum of one bucket is required")
+	}
+	return timeWindow{prefix: prefix, interval: interval, buckets: buckets, now: time.Now}, nil
+}
+
+// current returns the bucket the current time falls in
+func (w timeWindow) current() int64 {
+	return w.now().UnixNano() / int64(w.interval)
+}
+
+// live returns the buckets of the window, most recent first
+func (w timeWindow) live() []int64 {
+	return w.lastBuckets(w.buckets)
+}
+
+// lastBuckets returns the n most recent buckets, most recent first
+func (w timeWindow) lastBuckets(n int) []int64 {
+	current := w.current()
+	buckets := make([]int64, n)
+	for i := range buckets {
+		buckets[i] = current - int64(i)
+	}
+	return buckets
+}
+
+func (w timeWindow) key(bucket int64) string {
+	return w.prefix + ":" + strconv.FormatInt(bucket, 10)
+}
+
+func (w timeWindow) keys(buckets []int64) []string {
+	keys := make([]string, len(buckets))
+	for i, bucket := range buckets {
+		keys[i] = w.key(bucket)
+	}
+	return keys
+}
+
+// expireAt returns the Unix time in milliseconds at which bucket leaves the window
+func (w timeWindow) expireAt(bucket int64) int64 {
+	return (bucket + int64(w.buckets)) * int64(w.interval) / int64(time.Millisecond)
+}
+
+// bucketTracker remembers the most recent bucket known to exist on the server, so the structure of a bucket
+// is created once rather than before every write
+type bucketTracker struct {
+	mu     sync.Mutex
+	bucket int64
+}
+
+func newBucketTracker() *bucketTracker {
+	return &bucketTracker{bucket: -1}
+}
+
+func (t *bucketTracker) known(bucket int64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.bucket == bucket
+}
+
+func (t *bucketTracker) remember(bucket int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if bucket > t.bucket {
+		t.bucket = bucket
+	}
+}
+
+func (t *bucketTracker) forget(bucket int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.bucket == bucket {
+		t.bucket = -1
+	}
+}
+
+// isMissingKeyError reports whether err is the server error of a CMS or TOPK command on a key that does not exist
+func isMissingKeyError(err error) bool {
+	serverErr, ok := err.(redis.Error)
+	return ok && strings.Contains(string(serverErr), "does not exist")
+}
+
+// isExistingKeyError reports whether err is the server error of a CMS or TOPK command creating a key twice
+func isExistingKeyError(err error) bool {
+	serverErr, ok := err.(redis.Error)
+	return ok && strings.Contains(string(serverErr), "already exists")
+}
+
+// resetIn returns the time left until bucket ends
+func (w timeWindow) resetIn(bucket int64) time.Duration {
+	return time.Duration((bucket+1)*int64(w.interval) - w.now().UnixNano())
+}
@@ -0,0 +1,183 @@
+package redis_bloom_go
+
+import (
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// WindowedCmsOptions configures a WindowedCountMinSketch
+type WindowedCmsOptions struct {
+	// Interval is the time span covered by each underlying sketch
+	Interval time.Duration
+	// Buckets is the number of sketches that make up the window, which spans Interval*Buckets
+	Buckets int
+	// Width and Depth are the dimensions of every sketch, see CmsInitByDim
+	Width int64
+	Depth int64
+	// Weights optionally decays older intervals: Weights[i] multiplies the counts of the interval i intervals
+	// before the current one. Intervals without a weight count once.
+	Weights []int64
+}
+
+// WindowedCountMinSketch counts item frequencies over the last Interval*Buckets, with one Count-Min Sketch per
+// interval stored under prefix:<interval number>. Increments go to the sketch of the current interval, created on
+// first use with a TTL so it expires as it leaves the window. Frequencies are the (weighted) sum over all the
+// sketches of the window, either queried directly or merged into a scratch key.
+type WindowedCountMinSketch struct {
+	client *Client
+	opts   WindowedCmsOptions
+	window timeWindow
+	// initialized tracks the last sketch created, so it is not created again on every increment
+	initialized *bucketTracker
+}
+
+// NewWindowedCountMinSketch creates a WindowedCountMinSketch storing its sketches under prefix
+func NewWindowedCountMinSketch(client *Client, prefix string, opts WindowedCmsOptions) (*WindowedCountMinSketch, error) {
+	window, err := newTimeWindow(prefix, opts.Interval, opts.Buckets)
+	if err != nil {
+		return nil, err
+	}
+	return &WindowedCountMinSketch{client: client, opts: opts, window: window, initialized: newBucketTracker()}, nil
+}
+
+// Keys returns the keys of the sketches currently in the window, most recent first
+func (s *WindowedCountMinSketch) Keys() []string {
+	return s.window.keys(s.window.live())
+}
+
+// weight returns the weight of the interval age intervals before the current one
+func (s *WindowedCountMinSketch) weight(age int) int64 {
+	if age < len(s.opts.Weights) {
+		return s.opts.Weights[age]
+	}
+	return 1
+}
+
+// IncrBy increases the count of items by their increment in the sketch of the current interval
+func (s *WindowedCountMinSketch) IncrBy(itemIncrements map[string]int64) error {
+	bucket := s.window.current()
+	err := s.incrBy(bucket, itemIncrements)
+	if err != nil && isMissingKeyError(err) {
+		// the sketch was removed behind our back, create it again
+		s.initialized.forget(bucket)
+		err = s.incrBy(bucket, itemIncrements)
+	}
+	return err
+}
+
+func (s *WindowedCountMinSketch) incrBy(bucket int64, itemIncrements map[string]int64) error {
+	key := s.window.key(bucket)
+	args := redis.Args{key}
+	for item, incr := range itemIncrements {
+		args = args.Add(item, incr)
+	}
+	cmds := make([]pipelineCmd, 0, 3)
+	create := !s.initialized.known(bucket)
+	if create {
+		cmds = append(cmds, pipelineCmd{"CMS.INITBYDIM", redis.Args{key, s.opts.Width, s.opts.Depth}})
+	}
+	cmds = append(cmds,
+		pipelineCmd{"CMS.INCRBY", args},
+		pipelineCmd{"PEXPIREAT", redis.Args{key, s.window.expireAt(bucket)}},
+	)
+	conn := s.client.getConn()
+	defer conn.Close()
+	replies, err := doPipeline(conn, cmds)
+	if err != nil {
+		return err
+	}
+	if create {
+		// another client may have created the sketch first
+		if _, err := redis.String(replies[0], nil); err != nil && !isExistingKeyError(err) {
+			return err
+		}
+		replies = replies[1:]
+	}
+	if _, err = redis.Int64s(replies[0], nil); err != nil {
+		return err
+	}
+	s.initialized.remember(bucket)
+	return nil
+}
+
+// Query returns the count of items over the window, summing the weighted counts of every interval.
+// The sketches are queried with one pipelined CMS.QUERY each; intervals without a sketch count as zero.
+func (s *WindowedCountMinSketch) Query(items []string) ([]int64, error) {
+	keys := s.Keys()
+	cmds := make([]pipelineCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipelineCmd{"CMS.QUERY", redis.Args{key}.AddFlat(items)}
+	}
+	conn := s.client.getConn()
+	defer conn.Close()
+	replies, err := doPipeline(conn, cmds)
+	if err != nil {
+		return nil, err
+	}
+	counts := make([]int64, len(items))
+	for age, reply := range replies {
+		values, err := redis.Int64s(reply, nil)
+		if err != nil {
+			if isMissingKeyError(err) {
+				continue
+			}
+			return nil, err
+		}
+		if len(values) != len(items) {
+			return nil, replyDecoder{"CMS.QUERY"}.errorf("expects %d values, got %d", len(items), len(values))
+		}
+		for i, value := range values {
+			counts[i] += s.weight(age) * value
+		}
+	}
+	return counts, nil
+}
+
+// windowedCmsMergeScript merges the sketches of the window that exist into a fresh sketch, in a single atomic step.
+// KEYS[1] is the destination and KEYS[2..] the sketches of the window; ARGV is width, depth, expiry in
+// milliseconds, then the weight of every sketch. The destination is deleted when the merge fails.
+var windowedCmsMergeScript = redis.NewScript(-1, `
+local merge = {'CMS.MERGE', KEYS[1], 0}
+local weights = {}
+for i = 2, #KEYS do
+	if redis.call('EXISTS', KEYS[i]) == 1 then
+		table.insert(merge, KEYS[i])
+		table.insert(weights, ARGV[i + 2])
+	end
+end
+merge[3] = #weights
+redis.call('DEL', KEYS[1])
+redis.call('CMS.INITBYDIM', KEYS[1], ARGV[1], ARGV[2])
+if #weights > 0 then
+	table.insert(merge, 'WEIGHTS')
+	for _, weight in ipairs(weights) do
+		table.insert(merge, weight)
+	end
+	local reply = redis.pcall(unpack(merge))
+	if type(reply) == 'table' and reply.err then
+		redis.call('DEL', KEYS[1])
+		return reply
+	end
+end
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return 'OK'
+`)
+
+// Merge merges the sketches of the window, weighted by Weights, into a fresh sketch stored at dest and returns
+// dest. Any previous value of dest is replaced, and dest expires after one interval so scratch keys do not pile up.
+// The merge runs atomically in a server side script; when it fails dest is left deleted.
+// The merged sketch can then be queried with CmsQuery or CmsInfo.
+func (s *WindowedCountMinSketch) Merge(dest string) (string, error) {
+	keys := s.Keys()
+	args := redis.Args{1 + len(keys), dest}.AddFlat(keys).Add(s.opts.Width, s.opts.Depth, int64(s.opts.Interval/time.Millisecond))
+	for age := range keys {
+		args = args.Add(s.weight(age))
+	}
+	conn := s.client.getConn()
+	defer conn.Close()
+	if _, err := redis.String(windowedCmsMergeScript.Do(conn, args...)); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
@@ -0,0 +1,187 @@
+package redis_bloom_go
+
+import (
+	"testing"
+	"time"
+
+	"github.com/RedisBloom/redisbloom-go/internal/redistest"
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+// cmsServer keeps Count-Min sketches as exact counts, and runs windowedCmsMergeScript
+type cmsServer map[string]map[string]int64
+
+func (s cmsServer) reply(cmd string, args []interface{}) (interface{}, error) {
+	key, _ := args[0].(string)
+	switch cmd {
+	case "CMS.INITBYDIM":
+		if s[key] != nil {
+			return redis.Error("CMS: key already exists"), nil
+		}
+		s[key] = map[string]int64{}
+		return "OK", nil
+	case "CMS.INCRBY", "CMS.QUERY":
+		sketch := s[key]
+		if sketch == nil {
+			return redis.Error("CMS: key does not exist"), nil
+		}
+		var counts []interface{}
+		for i := 1; i < len(args); i++ {
+			item := args[i].(string)
+			if cmd == "CMS.INCRBY" {
+				i++
+				sketch[item] += args[i].(int64)
+			}
+			counts = append(counts, sketch[item])
+		}
+		return counts, nil
+	case "PEXPIREAT":
+		return int64(1), nil
+	case "EVALSHA", "EVAL":
+		numKeys := args[1].(int)
+		keys, argv := args[2:2+numKeys], args[2+numKeys:]
+		merged := map[string]int64{}
+		for i, src := range keys[1:] {
+			for item, count := range s[src.(string)] {
+				merged[item] += argv[3+i].(int64) * count
+			}
+		}
+		s[keys[0].(string)] = merged
+		return []byte("OK"), nil
+	}
+	return nil, redis.Error("ERR unknown command")
+}
+
+func newFakeWindowedCms(t *testing.T, server cmsServer, now *time.Time) (*WindowedCountMinSketch, *redistest.Pool) {
+	pool := &redistest.Pool{Reply: server.reply}
+	s, err := NewWindowedCountMinSketch(&Client{Pool: pool}, "hits", WindowedCmsOptions{
+		Interval: time.Minute,
+		Buckets:  3,
+		Width:    100,
+		Depth:    5,
+		Weights:  []int64{4, 2},
+	})
+	assert.Nil(t, err)
+	s.window.now = fakeClock(now)
+	return s, pool
+}
+
+func TestWindowedCountMinSketch_QueryFake(t *testing.T) {
+	now := time.Unix(8*60, 0)
+	s, _ := newFakeWindowedCms(t, cmsServer{}, &now)
+	assert.Nil(t, s.IncrBy(map[string]int64{"a": 1, "b": 3}))
+	// nothing is counted during the next interval, which has no sketch
+	now = now.Add(2 * time.Minute)
+	assert.Nil(t, s.IncrBy(map[string]int64{"a": 2}))
+
+	counts, err := s.Query([]string{"a", "b", "c"})
+	assert.Nil(t, err)
+	// 4*current + 2*previous (missing) + 1*oldest
+	assert.Equal(t, []int64{9, 3, 0}, counts)
+
+	// the oldest interval leaves the window
+	now = now.Add(time.Minute)
+	counts, err = s.Query([]string{"a", "b"})
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{4, 0}, counts)
+}
+
+func TestWindowedCountMinSketch_IncrByCreatesSketchOnceFake(t *testing.T) {
+	server := cmsServer{}
+	now := time.Unix(10*60, 0)
+	s, pool := newFakeWindowedCms(t, server, &now)
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, s.IncrBy(map[string]int64{"a": 1}))
+	}
+	assert.Equal(t, [][]interface{}{{"CMS.INITBYDIM", "hits:10", int64(100), int64(5)}}, pool.Sent("CMS.INITBYDIM"))
+	for _, cmd := range pool.Sent("PEXPIREAT") {
+		assert.Equal(t, []interface{}{"PEXPIREAT", "hits:10", int64(13 * 60 * 1000)}, cmd)
+	}
+
+	// a sketch deleted behind our back is created again
+	delete(server, "hits:10")
+	assert.Nil(t, s.IncrBy(map[string]int64{"a": 1}))
+	assert.Equal(t, map[string]int64{"a": 1}, server["hits:10"])
+}
+
+func TestWindowedCountMinSketch_MergeFake(t *testing.T) {
+	server := cmsServer{}
+	now := time.Unix(8*60, 0)
+	s, _ := newFakeWindowedCms(t, server, &now)
+	assert.Nil(t, s.IncrBy(map[string]int64{"a": 1, "b": 3}))
+	now = now.Add(2 * time.Minute)
+	assert.Nil(t, s.IncrBy(map[string]int64{"a": 2}))
+
+	server["merged"] = map[string]int64{"stale": 1}
+	dest, err := s.Merge("merged")
+	assert.Nil(t, err)
+	assert.Equal(t, "merged", dest)
+	// the merged sketch holds the weighted counts of the window, and nothing else
+	assert.Equal(t, map[string]int64{"a": 9, "b": 3}, server["merged"])
+
+	s.client.Pool = &redistest.Pool{Reply: func(cmd string, args []interface{}) (interface{}, error) {
+		return redis.Error("CMS: width/depth is not equal"), nil
+	}}
+	_, err = s.Merge("merged")
+	assert.EqualError(t, err, "CMS: width/depth is not equal")
+}
+
+func TestWindowedCountMinSketch(t *testing.T) {
+	client.FlushAll()
+	s, err := NewWindowedCountMinSketch(client, "test_windowed_cms", WindowedCmsOptions{
+		Interval: time.Minute,
+		Buckets:  2,
+		Width:    1000,
+		Depth:    5,
+		Weights:  []int64{2},
+	})
+	assert.Nil(t, err)
+	now := time.Now()
+	s.window.now = fakeClock(&now)
+
+	assert.Nil(t, s.IncrBy(map[string]int64{"a": 3, "b": 1}))
+	now = now.Add(time.Minute)
+	assert.Nil(t, s.IncrBy(map[string]int64{"a": 1}))
+
+	counts, err := s.Query([]string{"a", "b", "c"})
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{5, 1, 0}, counts)
+
+	dest, err := s.Merge("test_windowed_cms_merged")
+	assert.Nil(t, err)
+	counts, err = client.CmsQuery(dest, []string{"a", "b", "c"})
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{5, 1, 0}, counts)
+
+	// the first interval leaves the window
+	now = now.Add(time.Minute)
+	counts, err = s.Query([]string{"a", "b"})
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1, 0}, counts)
+
+	// a sketch deleted behind our back is created again
+	conn := client.Pool.Get()
+	defer conn.Close()
+	_, err = conn.Do("DEL", s.Keys()[0])
+	assert.Nil(t, err)
+	assert.Nil(t, s.IncrBy(map[string]int64{"a": 1}))
+	assert.Nil(t, s.IncrBy(map[string]int64{"a": 1}))
+	_, err = conn.Do("DEL", s.Keys()[0])
+	assert.Nil(t, err)
+	assert.Nil(t, s.IncrBy(map[string]int64{"c": 1}))
+	counts, err = s.Query([]string{"c"})
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{2}, counts)
+
+	// a sketch of other dimensions makes the merge fail, leaving no destination behind
+	_, err = conn.Do("DEL", s.Keys()[0])
+	assert.Nil(t, err)
+	_, err = client.CmsInitByDim(s.Keys()[0], 10, 2)
+	assert.Nil(t, err)
+	_, err = s.Merge("test_windowed_cms_merged")
+	assert.NotNil(t, err)
+	exists, err := redis.Bool(conn.Do("EXISTS", "test_windowed_cms_merged"))
+	assert.Nil(t, err)
+	assert.False(t, exists)
+}
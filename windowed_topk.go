@@ -0,0 +1,171 @@
+package redis_bloom_go
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// WindowedTopkOptions configures a WindowedTopK
+type WindowedTopkOptions struct {
+	// Interval is the time span covered by each underlying Top-K
+	Interval time.Duration
+	// Buckets is the number of intervals kept, which bounds the longest window that can be queried
+	Buckets int
+	// TopK, Width, Depth and Decay are the parameters of every Top-K, see TopkReserve.
+	// Width, Depth and Decay default to 8, 7 and 0.9 when 0, as on the server.
+	TopK  int64
+	Width int64
+	Depth int64
+	Decay float64
+}
+
+// WindowedTopK tracks the heaviest items over sliding windows, with one Top-K per interval stored under
+// prefix:<interval number>. Items are added to the Top-K of the current interval, created on first use with a TTL
+// so it expires once it is older than Buckets intervals. A query sums the listed counts of the intervals covering
+// the requested window and ranks the result. An item only contributes to the intervals where it made the list, so
+// the combined counts are lower bounds, and items that were never in any list are missing from the answer.
+type WindowedTopK struct {
+	client *Client
+	opts   WindowedTopkOptions
+	window timeWindow
+	// initialized tracks the last Top-K created, so it is not created again on every add
+	initialized *bucketTracker
+}
+
+// NewWindowedTopK creates a WindowedTopK storing its Top-K structures under prefix
+func NewWindowedTopK(client *Client, prefix string, opts WindowedTopkOptions) (*WindowedTopK, error) {
+	if opts.TopK < 1 {
+		return nil, errors.New("topk must be positive")
+	}
+	if opts.Width == 0 {
+		opts.Width = 8
+	}
+	if opts.Depth == 0 {
+		opts.Depth = 7
+	}
+	if opts.Decay == 0 {
+		opts.Decay = 0.9
+	}
+	if opts.Width < 0 || opts.Depth < 0 {
+		return nil, errors.New("width and depth must be positive")
+	}
+	if opts.Decay < 0 || opts.Decay > 1 {
+		return nil, errors.New("decay must be between 0 and 1")
+	}
+	window, err := newTimeWindow(prefix, opts.Interval, opts.Buckets)
+	if err != nil {
+		return nil, err
+	}
+	return &WindowedTopK{client: client, opts: opts, window: window, initialized: newBucketTracker()}, nil
+}
+
+// Keys returns the keys of the Top-K structures of all the intervals kept, most recent first
+func (w *WindowedTopK) Keys() []string {
+	return w.window.keys(w.window.live())
+}
+
+// Add adds items to the Top-K of the current interval, reporting for every item whether another item was
+// expelled from the list and which one, like TopkAddWithExpelled
+func (w *WindowedTopK) Add(items []string) ([]TopkAddResult, error) {
+	bucket := w.window.current()
+	expelled, err := w.add(bucket, items)
+	if err != nil && isMissingKeyError(err) {
+		// the Top-K was removed behind our back, create it again
+		w.initialized.forget(bucket)
+		expelled, err = w.add(bucket, items)
+	}
+	return expelled, err
+}
+
+func (w *WindowedTopK) add(bucket int64, items []string) ([]TopkAddResult, error) {
+	key := w.window.key(bucket)
+	cmds := make([]pipelineCmd, 0, 3)
+	create := !w.initialized.known(bucket)
+	if create {
+		args := redis.Args{key, w.opts.TopK, w.opts.Width, w.opts.Depth, strconv.FormatFloat(w.opts.Decay, 'g', 16, 64)}
+		cmds = append(cmds, pipelineCmd{"TOPK.RESERVE", args})
+	}
+	cmds = append(cmds,
+		pipelineCmd{"TOPK.ADD", redis.Args{key}.AddFlat(items)},
+		pipelineCmd{"PEXPIREAT", redis.Args{key, w.window.expireAt(bucket)}},
+	)
+	conn := w.client.getConn()
+	defer conn.Close()
+	replies, err := doPipeline(conn, cmds)
+	if err != nil {
+		return nil, err
+	}
+	if create {
+		// another client may have created the Top-K first
+		if _, err := redis.String(replies[0], nil); err != nil && !isExistingKeyError(err) {
+			return nil, err
+		}
+		replies = replies[1:]
+	}
+	values, err := replyDecoder{"TOPK.ADD"}.values(replies[0], nil)
+	if err != nil {
+		return nil, err
+	}
+	w.initialized.remember(bucket)
+	return w.client.topkExpelled(key, items, values)
+}
+
+// Query returns the TopK heaviest items over the last window, most frequent first.
+// The window is rounded up to whole intervals, current one included, and capped at Buckets intervals.
+func (w *WindowedTopK) Query(window time.Duration) ([]TopkItem, error) {
+	n := int((window + w.opts.Interval - 1) / w.opts.Interval)
+	if n < 1 {
+		n = 1
+	}
+	if n > w.opts.Buckets {
+		n = w.opts.Buckets
+	}
+	keys := w.window.keys(w.window.lastBuckets(n))
+	cmds := make([]pipelineCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipelineCmd{"TOPK.LIST", redis.Args{key, "WITHCOUNT"}}
+	}
+	conn := w.client.getConn()
+	defer conn.Close()
+	replies, err := doPipeline(conn, cmds)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64)
+	for _, reply := range replies {
+		items, err := ParseTopkListWithCount(redis.Values(reply, nil))
+		if err != nil {
+			if isMissingKeyError(err) {
+				continue
+			}
+			return nil, err
+		}
+		for _, item := range items {
+			counts[item.Item] += item.Count
+		}
+	}
+	return topkFromCounts(counts, w.opts.TopK), nil
+}
+
+// topkFromCounts returns the k items with the highest counts, ranked; ties are ordered by item
+func topkFromCounts(counts map[string]int64, k int64) []TopkItem {
+	items := make([]TopkItem, 0, len(counts))
+	for item, count := range counts {
+		items = append(items, TopkItem{Item: item, Count: count})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Count != items[j].Count {
+			return items[i].Count > items[j].Count
+		}
+		return items[i].Item < items[j].Item
+	})
+	if int64(len(items)) > k {
+		items = items[:k]
+	}
+	rankTopkItems(items)
+	return items
+}
@@ -0,0 +1,169 @@
+package redis_bloom_go
+
+import (
+	"testing"
+	"time"
+
+	"github.com/RedisBloom/redisbloom-go/internal/redistest"
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+// bucketLists answers TOPK.LIST for the buckets of the "top" windowed Top-K at minute 10:
+// the current bucket, a missing previous one, and older ones
+func bucketLists(cmd string, args []interface{}) (interface{}, error) {
+	switch args[0] {
+	case "top:10":
+		return []interface{}{"a", int64(5), "b", int64(2)}, nil
+	case "top:9":
+		return redis.Error("TopK: key does not exist"), nil
+	}
+	return []interface{}{"b", int64(4), "c", int64(3), "a", int64(1)}, nil
+}
+
+func newBucketedTopK(t *testing.T, pool *redistest.Pool) *WindowedTopK {
+	w, err := NewWindowedTopK(&Client{Pool: pool}, "top", WindowedTopkOptions{
+		Interval: time.Minute,
+		Buckets:  4,
+		TopK:     2,
+		Width:    50,
+		Depth:    3,
+		Decay:    0.9,
+	})
+	assert.Nil(t, err)
+	now := time.Unix(10*60, 0)
+	w.window.now = fakeClock(&now)
+	return w
+}
+
+func TestWindowedTopK_QueryCurrentBucket(t *testing.T) {
+	pool := &redistest.Pool{Reply: bucketLists}
+	w := newBucketedTopK(t, pool)
+	items, err := w.Query(time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, []TopkItem{{Item: "a", Count: 5, Rank: 1}, {Item: "b", Count: 2, Rank: 2}}, items)
+	assert.Equal(t, 1, len(pool.Sent("TOPK.LIST")))
+}
+
+func TestWindowedTopK_QuerySumsBuckets(t *testing.T) {
+	w := newBucketedTopK(t, &redistest.Pool{Reply: bucketLists})
+	// a partial interval reaches into the bucket it overlaps, the missing bucket counts as empty,
+	// and items with equal counts share their rank
+	items, err := w.Query(150 * time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, []TopkItem{{Item: "a", Count: 6, Rank: 1}, {Item: "b", Count: 6, Rank: 1}}, items)
+}
+
+func TestWindowedTopK_QueryCapsWindow(t *testing.T) {
+	pool := &redistest.Pool{Reply: bucketLists}
+	w := newBucketedTopK(t, pool)
+	_, err := w.Query(time.Hour)
+	assert.Nil(t, err)
+	var keys []interface{}
+	for _, cmd := range pool.Sent("TOPK.LIST") {
+		keys = append(keys, cmd[1])
+	}
+	assert.Equal(t, []interface{}{"top:10", "top:9", "top:8", "top:7"}, keys)
+}
+
+// topkAdds answers TOPK.ADD with no expulsion for "a" and the expulsion of an item named "" for "b"
+func topkAdds(cmd string, args []interface{}) (interface{}, error) {
+	switch cmd {
+	case "TOPK.RESERVE":
+		return "OK", nil
+	case "TOPK.ADD":
+		replies := make([]interface{}, len(args)-1)
+		for i, item := range args[1:] {
+			if item == "b" {
+				replies[i] = []byte("")
+			}
+		}
+		return replies, nil
+	}
+	return int64(1), nil
+}
+
+func TestWindowedTopK_AddReportsExpulsions(t *testing.T) {
+	w, err := NewWindowedTopK(&Client{Pool: &redistest.Pool{Reply: topkAdds}}, "top", WindowedTopkOptions{Interval: time.Minute, Buckets: 2, TopK: 3})
+	assert.Nil(t, err)
+	results, err := w.Add([]string{"a", "b"})
+	assert.Nil(t, err)
+	// an expelled item named "" is told apart from no expulsion
+	assert.Equal(t, []TopkAddResult{{Item: "a"}, {Item: "b", Expelled: true, ExpelledItem: ""}}, results)
+}
+
+func TestWindowedTopK_AddCreatesBucketOnce(t *testing.T) {
+	pool := &redistest.Pool{Reply: topkAdds}
+	w, err := NewWindowedTopK(&Client{Pool: pool}, "top", WindowedTopkOptions{Interval: time.Minute, Buckets: 2, TopK: 3})
+	assert.Nil(t, err)
+	now := time.Unix(10*60, 0)
+	w.window.now = fakeClock(&now)
+	for i := 0; i < 2; i++ {
+		_, err = w.Add([]string{"a"})
+		assert.Nil(t, err)
+	}
+	// the dimensions left out take the server defaults
+	assert.Equal(t, [][]interface{}{{"TOPK.RESERVE", "top:10", int64(3), int64(8), int64(7), "0.9"}}, pool.Sent("TOPK.RESERVE"))
+	// every addition keeps the bucket alive until it leaves the window
+	for _, cmd := range pool.Sent("PEXPIREAT") {
+		assert.Equal(t, []interface{}{"PEXPIREAT", "top:10", int64(12 * 60 * 1000)}, cmd)
+	}
+
+	// the next interval gets a Top-K of its own
+	now = now.Add(time.Minute)
+	_, err = w.Add([]string{"a"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(pool.Sent("TOPK.RESERVE")))
+	assert.Equal(t, "top:11", pool.Sent("TOPK.RESERVE")[1][1])
+}
+
+func TestWindowedTopK_InvalidOptions(t *testing.T) {
+	for _, opts := range []WindowedTopkOptions{
+		{Interval: time.Minute, Buckets: 4},
+		{Interval: time.Minute, Buckets: 2, TopK: 3, Width: -1},
+		{Interval: time.Minute, Buckets: 2, TopK: 3, Decay: 1.5},
+	} {
+		_, err := NewWindowedTopK(&Client{}, "top", opts)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestWindowedTopK(t *testing.T) {
+	client.FlushAll()
+	w, err := NewWindowedTopK(client, "test_windowed_topk", WindowedTopkOptions{
+		Interval: time.Minute,
+		Buckets:  3,
+		TopK:     3,
+		Width:    50,
+		Depth:    3,
+		Decay:    0.9,
+	})
+	assert.Nil(t, err)
+	now := time.Now()
+	w.window.now = fakeClock(&now)
+
+	_, err = w.Add([]string{"A", "A", "A", "B"})
+	assert.Nil(t, err)
+	now = now.Add(time.Minute)
+	expelled, err := w.Add([]string{"B", "B", "C"})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(expelled))
+
+	items, err := w.Query(time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, []TopkItem{{Item: "B", Count: 2, Rank: 1}, {Item: "C", Count: 1, Rank: 2}}, items)
+
+	items, err = w.Query(2 * time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, []TopkItem{
+		{Item: "A", Count: 3, Rank: 1},
+		{Item: "B", Count: 3, Rank: 1},
+		{Item: "C", Count: 1, Rank: 3},
+	}, items)
+
+	conn := client.Pool.Get()
+	defer conn.Close()
+	ttl, err := redis.Int64(conn.Do("PTTL", w.Keys()[0]))
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0)
+}